@@ -49,6 +49,12 @@
       refresh: function() {
         return api('post', './api/feeds/refresh')
       },
+      refresh_one: function(id) {
+        return api('post', './api/feeds/' + id + '/refresh').then(json)
+      },
+      refetch_icon: function(id) {
+        return api('post', './api/feeds/' + id + '/icon').then(json)
+      },
       list_errors: function() {
         return api('get', './api/feeds/errors').then(json)
       },
@@ -68,7 +74,10 @@
       },
       list_items: function(id) {
         return api('get', './api/folders/' + id + '/items').then(json)
-      }
+      },
+      refresh: function(id) {
+        return api('post', './api/folders/' + id + '/refresh').then(json)
+      },
     },
     items: {
       get: function(id) {
@@ -191,6 +191,7 @@ var vm = new Vue({
     api.feeds.list_errors().then(function(errors) {
       vm.feed_errors = errors
     })
+    this.listenEvents()
   },
   data: function() {
     var s = app.settings
@@ -232,6 +233,7 @@ var vm = new Vue({
       'refreshRate': s.refresh_rate,
       'authenticated': app.authenticated,
       'feed_errors': {},
+      'eventsConnected': false,
     }
   },
   computed: {
@@ -327,12 +329,13 @@ var vm = new Vue({
 
       api.items.get(newVal).then(function(item) {
         this.itemSelectedDetails = item
-        if (this.itemSelectedDetails.status == 'unread') {
-          api.items.update(this.itemSelectedDetails.id, {status: 'read'}).then(function() {
+        if (!this.itemSelectedDetails.is_read) {
+          api.items.update(this.itemSelectedDetails.id, {is_read: true}).then(function() {
             this.feedStats[this.itemSelectedDetails.feed_id].unread -= 1
             var itemInList = this.items.find(function(i) { return i.id == item.id })
-            if (itemInList) itemInList.status = 'read'
-            this.itemSelectedDetails.status = 'read'
+            if (itemInList) itemInList.is_read = true
+            this.itemSelectedDetails.is_read = true
+            if (item.cluster_id) this.refreshStats()
           }.bind(this))
         }
       }.bind(this))
@@ -362,20 +365,56 @@ var vm = new Vue({
       return api.status().then(function(data) {
         if (loopMode && !vm.itemSelected) vm.refreshItems()
 
-        vm.loading.feeds = data.running
-        if (data.running) {
+        vm.applyStatus(data)
+        // no need to poll if the server pushes the progress
+        if (data.running && !vm.eventsConnected) {
           setTimeout(vm.refreshStats.bind(vm, true), 500)
         }
-        vm.feedStats = data.stats.reduce(function(acc, stat) {
-          acc[stat.feed_id] = stat
-          return acc
-        }, {})
 
         api.feeds.list_errors().then(function(errors) {
           vm.feed_errors = errors
         })
       })
     },
+    applyStatus: function(data) {
+      this.loading.feeds = data.running
+      this.feedStats = data.stats.reduce(function(acc, stat) {
+        acc[stat.feed_id] = stat
+        return acc
+      }, {})
+    },
+    listenEvents: function() {
+      if (!window.EventSource) return
+
+      var refreshErrors = debounce(function() {
+        api.feeds.list_errors().then(function(errors) {
+          vm.feed_errors = errors
+        })
+      }, 500)
+      var refreshItems = debounce(function() {
+        if (!vm.itemSelected) vm.refreshItems()
+      }, 500)
+
+      // the browser reconnects by itself if the stream is interrupted
+      var events = new EventSource('./api/events')
+      events.onopen = function() { vm.eventsConnected = true }
+      events.onerror = function() { vm.eventsConnected = false }
+      events.addEventListener('status', function(e) {
+        vm.applyStatus(JSON.parse(e.data))
+      })
+      events.addEventListener('items_added', refreshItems)
+      events.addEventListener('feed_error', refreshErrors)
+      events.addEventListener('refresh_finished', refreshErrors)
+      events.addEventListener('settings', function(e) {
+        // only the settings shared by all the open tabs
+        var s = JSON.parse(e.data)
+        vm.theme.name = s.theme_name
+        vm.theme.font = s.theme_font
+        vm.theme.size = s.theme_size
+        vm.refreshRate = s.refresh_rate
+        vm.itemSortNewestFirst = s.sort_newest_first
+      })
+    },
     getItemsQuery: function() {
       var query = {}
       if (this.feedSelected) {
@@ -397,6 +436,7 @@ var vm = new Vue({
       if (!this.itemSortNewestFirst) {
         query.oldest_first = true
       }
+      query.collapse = true
       return query
     },
     refreshFeeds: function() {
@@ -421,12 +461,14 @@ var vm = new Vue({
 
       this.loading.items = true
       api.items.list(query).then(function(data) {
+        // malformed search queries come back with an error instead of the list
+        var list = data.list || []
         if (loadMore) {
-          vm.items = vm.items.concat(data.list)
+          vm.items = vm.items.concat(list)
         } else {
-          vm.items = data.list
+          vm.items = list
         }
-        vm.itemsHasMore = data.has_more
+        vm.itemsHasMore = !!data.has_more
         vm.loading.items = false
 
         // load more if there's some space left at the bottom of the item list.
@@ -565,30 +607,27 @@ var vm = new Vue({
         vm.loading.newfeed = false
       })
     },
-    toggleItemStatus: function(item, targetstatus, fallbackstatus) {
-      var oldstatus = item.status
-      var newstatus = item.status !== targetstatus ? targetstatus : fallbackstatus
+    toggleItemFlag: function(item, flag, stat, countWhenSet) {
+      var newval = !item[flag]
+      var data = {}
+      data[flag] = newval
 
-      var updateStats = function(status, incr) {
-        if ((status == 'unread') || (status == 'starred')) {
-          this.feedStats[item.feed_id][status] += incr
-        }
-      }.bind(this)
-
-      api.items.update(item.id, {status: newstatus}).then(function() {
-        updateStats(oldstatus, -1)
-        updateStats(newstatus, +1)
+      api.items.update(item.id, data).then(function() {
+        this.feedStats[item.feed_id][stat] += (newval == countWhenSet) ? +1 : -1
 
         var itemInList = this.items.find(function(i) { return i.id == item.id })
-        if (itemInList) itemInList.status = newstatus
-        item.status = newstatus
+        if (itemInList) itemInList[flag] = newval
+        item[flag] = newval
+
+        // duplicates from other feeds share the read state
+        if (flag == 'is_read' && item.cluster_id) this.refreshStats()
       }.bind(this))
     },
     toggleItemStarred: function(item) {
-      this.toggleItemStatus(item, 'starred', 'read')
+      this.toggleItemFlag(item, 'is_starred', 'starred', true)
     },
     toggleItemRead: function(item) {
-      this.toggleItemStatus(item, 'unread', 'read')
+      this.toggleItemFlag(item, 'is_read', 'unread', false)
     },
     importOPML: function(event) {
       var input = event.target
@@ -647,6 +686,36 @@ var vm = new Vue({
         vm.refreshStats()
       })
     },
+    fetchFeed: function(feed) {
+      api.feeds.refresh_one(feed.id).then(function() {
+        vm.refreshStats()
+        vm.refreshItems(false)
+      })
+    },
+    toggleFeedPaused: function(feed) {
+      var paused = !feed.paused
+      api.feeds.update(feed.id, {paused: paused}).then(function() {
+        feed.paused = paused
+      })
+    },
+    toggleFeedFullContent: function(feed) {
+      var fullContent = !feed.full_content
+      api.feeds.update(feed.id, {full_content: fullContent}).then(function() {
+        feed.full_content = fullContent
+      })
+    },
+    refetchFeedIcon: function(feed) {
+      api.feeds.refetch_icon(feed.id).then(function(result) {
+        feed.has_icon = result.has_icon
+        vm.$set(feed, 'icon_refetched', Date.now())
+      })
+    },
+    fetchFolder: function(folder) {
+      api.folders.refresh(folder.id).then(function() {
+        vm.refreshStats()
+        vm.refreshItems(false)
+      })
+    },
     computeStats: function() {
       var filter = this.filterSelected
       if (!filter) {
@@ -0,0 +1,144 @@
+package diff
+
+import "strings"
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+type Chunk struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// edits beyond this number aren't worth showing word by word,
+// the texts are reported as replaced altogether instead
+const maxEdits = 1000
+
+// Words computes the word-by-word difference between the two texts
+// (using Myers' algorithm). Whitespace is normalized to single spaces.
+func Words(a, b string) []Chunk {
+	return words(strings.Fields(a), strings.Fields(b))
+}
+
+func words(a, b []string) []Chunk {
+	// common prefix & suffix are trimmed to keep the search space small
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	chunks := make([]Chunk, 0)
+	add := func(op Op, words []string) {
+		if len(words) == 0 {
+			return
+		}
+		text := strings.Join(words, " ")
+		if len(chunks) > 0 && chunks[len(chunks)-1].Op == op {
+			chunks[len(chunks)-1].Text += " " + text
+			return
+		}
+		chunks = append(chunks, Chunk{Op: op, Text: text})
+	}
+
+	add(Equal, a[:prefix])
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if ops, ok := shortestEdit(midA, midB); ok {
+		x, y := 0, 0
+		for _, op := range ops {
+			switch op {
+			case Equal:
+				add(Equal, midA[x:x+1])
+				x, y = x+1, y+1
+			case Delete:
+				add(Delete, midA[x:x+1])
+				x++
+			case Insert:
+				add(Insert, midB[y:y+1])
+				y++
+			}
+		}
+	} else {
+		add(Delete, midA)
+		add(Insert, midB)
+	}
+	add(Equal, a[len(a)-suffix:])
+	return chunks
+}
+
+// shortestEdit returns the sequence of operations transforming a into b,
+// or false if it takes more than `maxEdits` insertions & deletions.
+func shortestEdit(a, b []string) ([]Op, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxEdits {
+		max = maxEdits
+	}
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	trace := make([][]int, 0)
+
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, offset, n, m), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func backtrack(trace [][]int, offset, x, y int) []Op {
+	ops := make([]Op, 0)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, Equal)
+			x, y = x-1, y-1
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, Insert)
+			} else {
+				ops = append(ops, Delete)
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
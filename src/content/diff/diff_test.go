@@ -0,0 +1,63 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	testcases := []struct {
+		a, b string
+		want []Chunk
+	}{
+		{"", "", []Chunk{}},
+		{"same text", "same  text", []Chunk{{Equal, "same text"}}},
+		{"", "new", []Chunk{{Insert, "new"}}},
+		{"old", "", []Chunk{{Delete, "old"}}},
+		{
+			"the quick brown fox jumps",
+			"the slow brown fox jumps high",
+			[]Chunk{
+				{Equal, "the"},
+				{Delete, "quick"},
+				{Insert, "slow"},
+				{Equal, "brown fox jumps"},
+				{Insert, "high"},
+			},
+		},
+		{
+			"a b c a b b a",
+			"c b a b a c",
+			[]Chunk{
+				{Delete, "a b"},
+				{Equal, "c"},
+				{Insert, "b"},
+				{Equal, "a b"},
+				{Delete, "b"},
+				{Equal, "a"},
+				{Insert, "c"},
+			},
+		},
+	}
+	for _, testcase := range testcases {
+		have := Words(testcase.a, testcase.b)
+		if !reflect.DeepEqual(have, testcase.want) {
+			t.Errorf("invalid diff for %#v -> %#v\nwant: %#v\nhave: %#v", testcase.a, testcase.b, testcase.want, have)
+		}
+	}
+}
+
+func TestWordsTooManyEdits(t *testing.T) {
+	a := strings.Repeat("a ", maxEdits)
+	b := strings.Repeat("b ", maxEdits)
+	have := Words("same "+a, "same "+b)
+	want := []Chunk{
+		{Equal, "same"},
+		{Delete, strings.TrimSpace(a)},
+		{Insert, strings.TrimSpace(b)},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("expected the texts to be replaced altogether, have %d chunks", len(have))
+	}
+}
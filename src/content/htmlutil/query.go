@@ -1,14 +1,12 @@
 package htmlutil
 
 import (
-	"regexp"
+	"fmt"
 	"strings"
 
 	"golang.org/x/net/html"
 )
 
-var nodeNameRegex = regexp.MustCompile(`\w+|\*`)
-
 func FindNodes(node *html.Node, match func(*html.Node) bool) []*html.Node {
 	nodes := make([]*html.Node, 0)
 
@@ -43,17 +41,36 @@ func Closest(node *html.Node, sel string) *html.Node {
 }
 
 func NewMatcher(sel string) Matcher {
+	matcher, err := ParseSelector(sel)
+	if err != nil {
+		panic(err)
+	}
+	return matcher
+}
+
+// ParseSelector compiles the comma-separated list of CSS selectors.
+// Supported are the type (`p`, `*`), id (`#main`), class (`.post`)
+// & attribute (`[href]`, `[rel=next]`, with `~=`, `^=`, `$=` & `*=` too)
+// selectors, combined with the descendant (`div p`) & child (`ul > li`) combinators.
+func ParseSelector(sel string) (Matcher, error) {
+	p := &selectorParser{sel: sel}
 	multi := MultiMatch{}
-	parts := strings.Split(sel, ",")
-	for _, part := range parts {
-		part := strings.TrimSpace(part)
-		if nodeNameRegex.MatchString(part) {
-			multi.Add(ElementMatch{Name: part})
-		} else {
-			panic("unsupported selector: " + part)
+	for {
+		p.skipSpace()
+		start := p.pos
+		matcher, err := p.complex()
+		if err != nil {
+			return nil, err
+		}
+		if matcher == nil {
+			return nil, fmt.Errorf("unsupported selector: %s", strings.TrimSpace(p.sel[start:p.until(',')]))
 		}
+		multi.Add(matcher)
+		if p.eof() {
+			return multi, nil
+		}
+		p.pos++ // ','
 	}
-	return multi
 }
 
 type Matcher interface {
@@ -84,3 +101,281 @@ func (m MultiMatch) Match(n *html.Node) bool {
 	}
 	return false
 }
+
+// CompoundMatch matches the elements satisfying all of its simple selectors
+// (like `a.external[href]`).
+type CompoundMatch struct {
+	Name    string
+	ID      string
+	Classes []string
+	Attrs   []AttrMatch
+}
+
+func (m CompoundMatch) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if m.Name != "" && m.Name != "*" && n.Data != m.Name {
+		return false
+	}
+	if m.ID != "" && Attr(n, "id") != m.ID {
+		return false
+	}
+	if len(m.Classes) > 0 {
+		classes := strings.Fields(Attr(n, "class"))
+		for _, class := range m.Classes {
+			if !containsString(classes, class) {
+				return false
+			}
+		}
+	}
+	for _, attr := range m.Attrs {
+		if !attr.Match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+type AttrMatch struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+func (m AttrMatch) Match(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if !strings.EqualFold(a.Key, m.Key) {
+			continue
+		}
+		switch m.Op {
+		case "":
+			return true
+		case "=":
+			return a.Val == m.Value
+		case "~=":
+			return containsString(strings.Fields(a.Val), m.Value)
+		case "^=":
+			return m.Value != "" && strings.HasPrefix(a.Val, m.Value)
+		case "$=":
+			return m.Value != "" && strings.HasSuffix(a.Val, m.Value)
+		case "*=":
+			return m.Value != "" && strings.Contains(a.Val, m.Value)
+		}
+	}
+	return false
+}
+
+// ComplexMatch matches the chain of compound selectors
+// joined by the descendant (' ') or child ('>') combinators.
+type ComplexMatch struct {
+	compounds   []Matcher
+	combinators []byte
+}
+
+func (m ComplexMatch) Match(n *html.Node) bool {
+	return m.matchAt(n, len(m.compounds)-1)
+}
+
+func (m ComplexMatch) matchAt(n *html.Node, i int) bool {
+	if !m.compounds[i].Match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	if m.combinators[i-1] == '>' {
+		return n.Parent != nil && m.matchAt(n.Parent, i-1)
+	}
+	for p := n.Parent; p != nil; p = p.Parent {
+		if m.matchAt(p, i-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+type selectorParser struct {
+	sel string
+	pos int
+}
+
+func (p *selectorParser) eof() bool {
+	return p.pos >= len(p.sel)
+}
+
+func (p *selectorParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.sel[p.pos]
+}
+
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for !p.eof() && strings.IndexByte(" \t\r\n\f", p.peek()) != -1 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+// until returns the position of the next `c` (or the end of the selector).
+func (p *selectorParser) until(c byte) int {
+	if i := strings.IndexByte(p.sel[p.pos:], c); i != -1 {
+		return p.pos + i
+	}
+	return len(p.sel)
+}
+
+func (p *selectorParser) ident() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c == '-' || c == '_' || c >= 0x80 ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			p.pos++
+		} else {
+			break
+		}
+	}
+	return p.sel[start:p.pos]
+}
+
+// complex parses the selector up to the next ',' (or the end).
+// Returns nil if there's nothing to parse.
+func (p *selectorParser) complex() (Matcher, error) {
+	m := ComplexMatch{}
+	for {
+		compound, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+		if compound == nil {
+			if len(m.compounds) > 0 {
+				return nil, fmt.Errorf("unsupported selector: %s", p.sel[p.pos:p.until(',')])
+			}
+			return nil, nil
+		}
+		m.compounds = append(m.compounds, compound)
+
+		combinator := byte(' ')
+		space := p.skipSpace()
+		if p.peek() == '>' {
+			combinator = '>'
+			p.pos++
+			p.skipSpace()
+		} else if p.eof() || p.peek() == ',' {
+			break
+		} else if !space {
+			return nil, fmt.Errorf("unsupported selector: %s", p.sel[p.pos:p.until(',')])
+		}
+		m.combinators = append(m.combinators, combinator)
+	}
+	if len(m.compounds) == 1 {
+		return m.compounds[0], nil
+	}
+	return m, nil
+}
+
+func (p *selectorParser) compound() (Matcher, error) {
+	m := CompoundMatch{}
+	empty := true
+	if p.peek() == '*' {
+		p.pos++
+		m.Name = "*"
+		empty = false
+	} else if name := p.ident(); name != "" {
+		m.Name = strings.ToLower(name)
+		empty = false
+	}
+	for !p.eof() {
+		switch p.peek() {
+		case '#', '.':
+			c := p.peek()
+			p.pos++
+			name := p.ident()
+			if name == "" {
+				return nil, fmt.Errorf("missing name after %q in: %s", c, p.sel)
+			}
+			if c == '#' {
+				m.ID = name
+			} else {
+				m.Classes = append(m.Classes, name)
+			}
+		case '[':
+			p.pos++
+			attr, err := p.attr()
+			if err != nil {
+				return nil, err
+			}
+			m.Attrs = append(m.Attrs, attr)
+		default:
+			if empty {
+				return nil, nil
+			}
+			return m.simplify(), nil
+		}
+		empty = false
+	}
+	if empty {
+		return nil, nil
+	}
+	return m.simplify(), nil
+}
+
+// simplify keeps the plain element selectors as they used to be.
+func (m CompoundMatch) simplify() Matcher {
+	if m.ID == "" && len(m.Classes) == 0 && len(m.Attrs) == 0 {
+		return ElementMatch{Name: m.Name}
+	}
+	return m
+}
+
+func (p *selectorParser) attr() (AttrMatch, error) {
+	m := AttrMatch{}
+	p.skipSpace()
+	if m.Key = p.ident(); m.Key == "" {
+		return m, fmt.Errorf("missing attribute name in: %s", p.sel)
+	}
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.pos++
+		return m, nil
+	}
+	for _, op := range []string{"=", "~=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.sel[p.pos:], op) {
+			m.Op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if m.Op == "" {
+		return m, fmt.Errorf("unsupported attribute selector in: %s", p.sel)
+	}
+	p.skipSpace()
+	if quote := p.peek(); quote == '"' || quote == '\'' {
+		end := strings.IndexByte(p.sel[p.pos+1:], quote)
+		if end == -1 {
+			return m, fmt.Errorf("unterminated string in: %s", p.sel)
+		}
+		m.Value = p.sel[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+	} else {
+		m.Value = p.ident()
+	}
+	p.skipSpace()
+	if p.peek() != ']' {
+		return m, fmt.Errorf("unterminated attribute selector in: %s", p.sel)
+	}
+	p.pos++
+	return m, nil
+}
@@ -85,3 +85,62 @@ func TestClosest(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestQuerySelectors(t *testing.T) {
+	node, _ := html.Parse(strings.NewReader(`
+		<!DOCTYPE html>
+		<html lang="en">
+		<body>
+			<ul id="posts">
+				<li class="post featured"><a href="/one" rel="bookmark">one</a></li>
+				<li class="post"><p><a href="/two">two</a></p></li>
+				<li class="ad"><a href="https://ads.example.com/">ad</a></li>
+			</ul>
+		</body>
+		</html>
+	`))
+	testcases := []struct {
+		sel  string
+		want []string
+	}{
+		{"li.post a", []string{"one", "two"}},
+		{"li.post > a", []string{"one"}},
+		{"#posts .featured", []string{"one"}},
+		{"ul#posts > li.post.featured", []string{"one"}},
+		{"a[rel]", []string{"one"}},
+		{`a[rel="bookmark"]`, []string{"one"}},
+		{"li[class~=post] p a", []string{"two"}},
+		{"a[href^=https]", []string{"ad"}},
+		{"a[href$='/two']", []string{"two"}},
+		{"a[href*=ads]", []string{"ad"}},
+		{"body li:not(a)", nil},
+	}
+	for _, testcase := range testcases {
+		matcher, err := ParseSelector(testcase.sel)
+		if testcase.want == nil {
+			if err == nil {
+				t.Errorf("%q: expected an error", testcase.sel)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", testcase.sel, err)
+			continue
+		}
+		have := make([]string, 0)
+		for _, n := range FindNodes(node, matcher.Match) {
+			have = append(have, Text(n))
+		}
+		if strings.Join(have, ",") != strings.Join(testcase.want, ",") {
+			t.Errorf("%q: want %v, have %v", testcase.sel, testcase.want, have)
+		}
+	}
+}
+
+func TestParseSelectorInvalid(t *testing.T) {
+	for _, sel := range []string{"", "a,", "a >", "a[", "a[href", "a[href=x", "a[href|=x]", ".", "a!b"} {
+		if _, err := ParseSelector(sel); err == nil {
+			t.Errorf("%q: expected an error", sel)
+		}
+	}
+}
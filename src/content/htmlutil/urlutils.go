@@ -2,6 +2,7 @@ package htmlutil
 
 import (
 	"net/url"
+	"sort"
 	"strings"
 )
 
@@ -36,3 +37,49 @@ func URLDomain(val string) string {
 func IsAPossibleLink(val string) bool {
 	return strings.HasPrefix(val, "http://") || strings.HasPrefix(val, "https://")
 }
+
+// query parameters added by trackers & newsletters (along with `utm_*` & `mc_*`),
+// they don't change the resource the url points to. The ambiguous ones
+// (e.g. `ref` or `source`) are kept, as some sites do rely on them.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true,
+}
+
+// NormalizeURL reduces the url to a form suitable for comparison:
+// the scheme, "www." prefix, fragment, tracking parameters & trailing slash
+// are dropped, the remaining query parameters are sorted.
+// Returns an empty string if the value isn't an absolute http(s) url.
+func NormalizeURL(val string) string {
+	u, err := url.Parse(strings.TrimSpace(val))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") || strings.HasPrefix(key, "mc_") || trackingParams[key] {
+			query.Del(key)
+		}
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			params = append(params, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+
+	result := host + strings.TrimRight(u.EscapedPath(), "/")
+	if len(params) > 0 {
+		result += "?" + strings.Join(params, "&")
+	}
+	return result
+}
@@ -0,0 +1,26 @@
+package htmlutil
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	testcases := [][2]string{
+		{"example.com/post", "https://example.com/post"},
+		{"example.com/post", "http://www.Example.com/post/"},
+		{"example.com/post", "https://example.com:443/post#comments"},
+		{"example.com:8080/post", "https://example.com:8080/post"},
+		{"example.com/post?a=1&b=2", "https://example.com/post?b=2&utm_source=rss&a=1&fbclid=x"},
+		{"example.com/post", "https://example.com/post?mc_cid=1&mc_eid=2&gclid=3"},
+		{"example.com/tree?ref=main", "https://example.com/tree?ref=main"},
+		{"example.com/search?q=go&source=hp", "https://example.com/search?source=hp&q=go"},
+		{"example.com", "https://example.com/"},
+		{"", "/relative/link"},
+		{"", "mailto:someone@example.com"},
+	}
+	for _, testcase := range testcases {
+		want := testcase[0]
+		have := NormalizeURL(testcase[1])
+		if want != have {
+			t.Errorf("invalid url for %#v\nwant: %#v\nhave: %#v", testcase[1], want, have)
+		}
+	}
+}
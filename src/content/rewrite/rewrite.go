@@ -0,0 +1,197 @@
+// Package rewrite cleans up the content of the feeds which wrap it in junk
+// (tracking pixels, ads, "continue reading" footers), or need their URLs fixed.
+package rewrite
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+	"github.com/nkanaev/yarr/src/content/readability"
+	"golang.org/x/net/html"
+)
+
+// step types
+const (
+	// remove the elements matching the selector
+	Remove = "remove"
+	// replace the pattern's matches in the html
+	Replace = "replace"
+	// replace the pattern's matches in the images' `src` & `srcset`
+	ImageURL = "image_url"
+	// replace the lazy-loaded images with the ones inside `noscript`
+	Noscript = "noscript"
+	// swap the content with the main part found by readability
+	Readability = "readability"
+)
+
+type Step struct {
+	Type        string `json:"type"`
+	Selector    string `json:"selector,omitempty"`
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// Pipeline is the list of steps applied to the content in order.
+type Pipeline []Step
+
+// compiledStep is the step with its selector or pattern parsed.
+type compiledStep struct {
+	Step
+	matcher htmlutil.Matcher
+	re      *regexp.Regexp
+}
+
+func (s Step) compile() (compiledStep, error) {
+	step := compiledStep{Step: s}
+	switch s.Type {
+	case Remove:
+		if strings.TrimSpace(s.Selector) == "" {
+			return step, errors.New("remove step requires selector")
+		}
+		matcher, err := htmlutil.ParseSelector(s.Selector)
+		if err != nil {
+			return step, err
+		}
+		step.matcher = matcher
+		return step, nil
+	case Replace, ImageURL:
+		if s.Pattern == "" {
+			return step, errors.New(s.Type + " step requires pattern")
+		}
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return step, errors.New("invalid regex: " + err.Error())
+		}
+		step.re = re
+		return step, nil
+	case Noscript, Readability:
+		return step, nil
+	}
+	return step, errors.New("step type must be one of: remove, replace, image_url, noscript, readability")
+}
+
+func (s Step) Validate() error {
+	_, err := s.compile()
+	return err
+}
+
+func (p Pipeline) Validate() error {
+	for _, step := range p {
+		if err := step.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rewriter is the pipeline ready to be applied to any number of items,
+// with the selectors & the patterns parsed once.
+type Rewriter struct {
+	steps []compiledStep
+}
+
+// Compile prepares the pipeline to be applied. Invalid steps are skipped.
+func (p Pipeline) Compile() *Rewriter {
+	r := &Rewriter{steps: make([]compiledStep, 0, len(p))}
+	for _, step := range p {
+		if compiled, err := step.compile(); err == nil {
+			r.steps = append(r.steps, compiled)
+		}
+	}
+	return r
+}
+
+// Apply runs the content through the steps. Invalid steps are skipped.
+func (p Pipeline) Apply(content string) string {
+	return p.Compile().Apply(content)
+}
+
+// Empty tells whether there's nothing to apply.
+func (r *Rewriter) Empty() bool {
+	return len(r.steps) == 0
+}
+
+// Apply runs the content through the steps.
+func (r *Rewriter) Apply(content string) string {
+	for _, step := range r.steps {
+		switch step.Type {
+		case Remove:
+			content = transform(content, func(body *html.Node) {
+				for _, n := range htmlutil.FindNodes(body, step.matcher.Match) {
+					if n.Parent != nil {
+						n.Parent.RemoveChild(n)
+					}
+				}
+			})
+		case Replace:
+			content = step.re.ReplaceAllString(content, step.Replacement)
+		case ImageURL:
+			content = transform(content, func(body *html.Node) {
+				for _, n := range htmlutil.Query(body, "img,source") {
+					for i, a := range n.Attr {
+						if a.Key == "src" || a.Key == "srcset" {
+							n.Attr[i].Val = step.re.ReplaceAllString(a.Val, step.Replacement)
+						}
+					}
+				}
+			})
+		case Noscript:
+			content = transform(content, unwrapNoscript)
+		case Readability:
+			if article, err := readability.ExtractContent(strings.NewReader(content)); err == nil && article != "" {
+				content = article
+			}
+		}
+	}
+	return content
+}
+
+// transform parses the content, lets fn modify the document's body & renders it back.
+func transform(content string, fn func(body *html.Node)) string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return content
+	}
+	bodies := htmlutil.Query(doc, "body")
+	if len(bodies) == 0 {
+		return content
+	}
+	fn(bodies[0])
+	return htmlutil.InnerHTML(bodies[0])
+}
+
+// unwrapNoscript replaces `noscript` elements containing images with their content
+// (parsed as text by the scripting-enabled parser) & drops the placeholder images before them.
+func unwrapNoscript(body *html.Node) {
+	for _, n := range htmlutil.Query(body, "noscript") {
+		if n.Parent == nil || n.FirstChild == nil || n.FirstChild.Type != html.TextNode {
+			continue
+		}
+		nodes, err := html.ParseFragment(strings.NewReader(n.FirstChild.Data), n.Parent)
+		if err != nil {
+			continue
+		}
+		hasImage := false
+		for _, node := range nodes {
+			if len(htmlutil.Query(node, "img")) > 0 {
+				hasImage = true
+			}
+		}
+		if !hasImage {
+			continue
+		}
+		prev := n.PrevSibling
+		for prev != nil && prev.Type == html.TextNode && strings.TrimSpace(prev.Data) == "" {
+			prev = prev.PrevSibling
+		}
+		if prev != nil && prev.Type == html.ElementNode && prev.Data == "img" {
+			n.Parent.RemoveChild(prev)
+		}
+		for _, node := range nodes {
+			n.Parent.InsertBefore(node, n)
+		}
+		n.Parent.RemoveChild(n)
+	}
+}
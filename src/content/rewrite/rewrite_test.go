@@ -0,0 +1,73 @@
+package rewrite
+
+import "testing"
+
+func TestPipelineApply(t *testing.T) {
+	testcases := []struct {
+		name     string
+		pipeline Pipeline
+		input    string
+		want     string
+	}{
+		{
+			"remove",
+			Pipeline{{Type: Remove, Selector: "img[width=\"1\"], .ad"}},
+			`<p>text<img src="/pixel.gif" width="1"/></p><div class="ad">buy</div>`,
+			`<p>text</p>`,
+		},
+		{
+			"replace",
+			Pipeline{{Type: Replace, Pattern: `(?s)<p>Continue reading.*?</p>`}},
+			`<p>text</p><p>Continue reading <a href="/">here</a></p>`,
+			`<p>text</p>`,
+		},
+		{
+			"image url",
+			Pipeline{{Type: ImageURL, Pattern: `^http://cdn\.example\.com/(.*)$`, Replacement: "https://images.example.com/$1"}},
+			`<img src="http://cdn.example.com/a.jpg" alt="http://cdn.example.com/a.jpg"/>`,
+			`<img src="https://images.example.com/a.jpg" alt="http://cdn.example.com/a.jpg"/>`,
+		},
+		{
+			"noscript",
+			Pipeline{{Type: Noscript}},
+			`<p><img src="placeholder.gif" data-src="a.jpg"/> <noscript><img src="a.jpg"/></noscript></p><noscript>enable js</noscript>`,
+			`<p> <img src="a.jpg"/></p><noscript>enable js</noscript>`,
+		},
+		{
+			"in order",
+			Pipeline{{Type: Replace, Pattern: "foo", Replacement: "bar"}, {Type: Replace, Pattern: "bar", Replacement: "baz"}},
+			`foo`,
+			`baz`,
+		},
+		{
+			"invalid step",
+			Pipeline{{Type: Replace, Pattern: "("}},
+			`<p>text</p>`,
+			`<p>text</p>`,
+		},
+	}
+	for _, tc := range testcases {
+		if have := tc.pipeline.Apply(tc.input); have != tc.want {
+			t.Errorf("%s\nwant: %q\nhave: %q", tc.name, tc.want, have)
+		}
+	}
+}
+
+func TestPipelineValidate(t *testing.T) {
+	invalid := []Pipeline{
+		{{Type: "strip"}},
+		{{Type: Remove}},
+		{{Type: Remove, Selector: "p:first"}},
+		{{Type: Replace, Pattern: "("}},
+		{{Type: ImageURL}},
+	}
+	for _, p := range invalid {
+		if p.Validate() == nil {
+			t.Errorf("expected pipeline to be invalid: %#v", p)
+		}
+	}
+	valid := Pipeline{{Type: Noscript}, {Type: Readability}, {Type: Remove, Selector: "p.ad"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected pipeline to be valid: %s", err)
+	}
+}
@@ -1,6 +1,7 @@
 package scraper
 
 import (
+	"encoding/json"
 	"strings"
 
 	"github.com/nkanaev/yarr/src/content/htmlutil"
@@ -81,17 +82,55 @@ func FindIcons(body string, base string) []string {
 		return icons
 	}
 
-	// css: link[rel=icon]
+	// css: link[rel=icon], link[rel=apple-touch-icon]
 	isLink := func(n *html.Node) bool {
 		return n.Type == html.ElementNode && n.Data == "link"
 	}
 	for _, node := range htmlutil.FindNodes(doc, isLink) {
-		rels := strings.Split(htmlutil.Attr(node, "rel"), " ")
-		for _, rel := range rels {
-			if strings.EqualFold(rel, "icon") {
-				icons = append(icons, htmlutil.AbsoluteUrl(htmlutil.Attr(node, "href"), base))
+		for _, rel := range strings.Fields(htmlutil.Attr(node, "rel")) {
+			rel = strings.ToLower(rel)
+			if rel == "icon" || rel == "apple-touch-icon" || rel == "apple-touch-icon-precomposed" {
+				if href := htmlutil.Attr(node, "href"); href != "" {
+					icons = append(icons, htmlutil.AbsoluteUrl(href, base))
+				}
+				break
+			}
+		}
+	}
+	return icons
+}
+
+// FindManifest returns the link to the web app manifest (`link[rel=manifest]`).
+func FindManifest(body string, base string) string {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	for _, node := range htmlutil.Query(doc, "link") {
+		for _, rel := range strings.Fields(htmlutil.Attr(node, "rel")) {
+			if strings.EqualFold(rel, "manifest") && htmlutil.Attr(node, "href") != "" {
+				return htmlutil.AbsoluteUrl(htmlutil.Attr(node, "href"), base)
 			}
 		}
 	}
+	return ""
+}
+
+// ManifestIcons returns the links to the icons listed in the web app manifest.
+func ManifestIcons(data []byte, base string) []string {
+	icons := make([]string, 0)
+	var manifest struct {
+		Icons []struct {
+			Src string `json:"src"`
+		} `json:"icons"`
+	}
+	if json.Unmarshal(data, &manifest) != nil {
+		return icons
+	}
+	for _, icon := range manifest.Icons {
+		if icon.Src != "" {
+			icons = append(icons, htmlutil.AbsoluteUrl(icon.Src, base))
+		}
+	}
 	return icons
 }
@@ -81,6 +81,8 @@ func TestFindIcons(t *testing.T) {
 			<title></title>
 			<link rel="icon favicon" href="/favicon.ico">
 			<link rel="icon macicon" href="path/to/favicon.png">
+			<link rel="apple-touch-icon" sizes="180x180" href="/apple-touch-icon.png">
+			<link rel="stylesheet" href="/style.css">
 		</head>
 		<body>
 			
@@ -88,7 +90,28 @@ func TestFindIcons(t *testing.T) {
 		</html>
 	`
 	have := FindIcons(body, base)
-	want := []string{base + "/favicon.ico", base + "/path/to/favicon.png"}
+	want := []string{base + "/favicon.ico", base + "/path/to/favicon.png", base + "/apple-touch-icon.png"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fatal("invalid result")
+	}
+}
+
+func TestManifestIcons(t *testing.T) {
+	body := `<html><head><link rel="manifest" href="/site.webmanifest"></head></html>`
+	manifest := FindManifest(body, base)
+	if manifest != base+"/site.webmanifest" {
+		t.Fatalf("invalid manifest link: %#v", manifest)
+	}
+	have := ManifestIcons([]byte(`{
+		"name": "Example",
+		"icons": [
+			{"src": "/android-chrome-192x192.png", "sizes": "192x192", "type": "image/png"},
+			{"src": "icons/icon.svg", "sizes": "any", "type": "image/svg+xml"}
+		]
+	}`), manifest)
+	want := []string{base + "/android-chrome-192x192.png", base + "/icons/icon.svg"}
 	if !reflect.DeepEqual(have, want) {
 		t.Logf("want: %#v", want)
 		t.Logf("have: %#v", have)
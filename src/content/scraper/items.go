@@ -0,0 +1,120 @@
+package scraper
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+	"golang.org/x/net/html"
+)
+
+// Selectors describe how to make up the items of a page without a feed.
+// `Item` matches the items' containers, the rest of the CSS selectors
+// are looked up within them.
+type Selectors struct {
+	Item    string `json:"item"`
+	Title   string `json:"title,omitempty"`
+	Link    string `json:"link,omitempty"`
+	Date    string `json:"date,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+func (s Selectors) Validate() error {
+	if strings.TrimSpace(s.Item) == "" {
+		return errors.New("item selector is required")
+	}
+	for _, sel := range []string{s.Item, s.Title, s.Link, s.Date, s.Content} {
+		if sel == "" {
+			continue
+		}
+		if _, err := htmlutil.ParseSelector(sel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Item is what the selectors found in an item's container.
+// The link is as it appears on the page (possibly relative).
+type Item struct {
+	Title   string
+	Link    string
+	Date    string
+	Content string
+}
+
+// FindItems extracts the items from the page. Returns the page's title too.
+// If not given, the link is the first one in the container
+// & the title is the link's text.
+func FindItems(body string, s Selectors) (string, []Item, error) {
+	if err := s.Validate(); err != nil {
+		return "", nil, err
+	}
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", nil, err
+	}
+
+	isLink := func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == "a" && htmlutil.Attr(n, "href") != ""
+	}
+	first := func(node *html.Node, sel string) *html.Node {
+		if sel == "" {
+			return nil
+		}
+		if nodes := htmlutil.Query(node, sel); len(nodes) > 0 {
+			return nodes[0]
+		}
+		return nil
+	}
+	firstLink := func(node *html.Node) *html.Node {
+		if nodes := htmlutil.FindNodes(node, isLink); len(nodes) > 0 {
+			return nodes[0]
+		}
+		return nil
+	}
+
+	title := ""
+	if node := first(doc, "title"); node != nil {
+		title = text(node)
+	}
+
+	items := make([]Item, 0)
+	for _, container := range htmlutil.Query(doc, s.Item) {
+		var item Item
+
+		var link *html.Node
+		if s.Link == "" {
+			link = firstLink(container)
+		} else if link = first(container, s.Link); link != nil && !isLink(link) {
+			link = firstLink(link)
+		}
+		if link != nil {
+			item.Link = htmlutil.Attr(link, "href")
+		}
+
+		if node := first(container, s.Title); node != nil {
+			item.Title = text(node)
+		} else if s.Title == "" && link != nil {
+			item.Title = text(link)
+		}
+		if node := first(container, s.Date); node != nil {
+			item.Date = htmlutil.Attr(node, "datetime")
+			if item.Date == "" {
+				item.Date = text(node)
+			}
+		}
+		if node := first(container, s.Content); node != nil {
+			item.Content = htmlutil.InnerHTML(node)
+		}
+
+		if item.Link != "" || item.Title != "" {
+			items = append(items, item)
+		}
+	}
+	return title, items, nil
+}
+
+func text(node *html.Node) string {
+	return strings.Join(strings.Fields(htmlutil.Text(node)), " ")
+}
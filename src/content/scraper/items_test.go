@@ -0,0 +1,74 @@
+package scraper
+
+import (
+	"reflect"
+	"testing"
+)
+
+const itemsPage = `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head><title> News </title></head>
+	<body>
+		<div class="news">
+			<article>
+				<h2><a href="/one">First   post</a></h2>
+				<time datetime="2021-03-04T05:06:07Z">March 4</time>
+				<div class="body"><p>one</p></div>
+			</article>
+			<article>
+				<h2>Second post</h2>
+				<span class="date">2021-03-05</span>
+				<a class="more" href="/two">read more</a>
+			</article>
+			<article><p>nothing here</p></article>
+		</div>
+	</body>
+	</html>
+`
+
+func TestFindItems(t *testing.T) {
+	title, items, err := FindItems(itemsPage, Selectors{
+		Item:    ".news article",
+		Title:   "h2",
+		Date:    "time, .date",
+		Content: ".body",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "News" {
+		t.Errorf("invalid title: %q", title)
+	}
+	want := []Item{
+		{Title: "First post", Link: "/one", Date: "2021-03-04T05:06:07Z", Content: "<p>one</p>"},
+		{Title: "Second post", Link: "/two", Date: "2021-03-05"},
+	}
+	if !reflect.DeepEqual(want, items) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", items)
+		t.Fatal("invalid items")
+	}
+}
+
+func TestFindItemsDefaults(t *testing.T) {
+	_, items, _ := FindItems(itemsPage, Selectors{Item: "article", Link: "a.more"})
+	want := []Item{{Title: "read more", Link: "/two"}}
+	if !reflect.DeepEqual(want, items) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", items)
+		t.Fatal("invalid items")
+	}
+}
+
+func TestSelectorsValidate(t *testing.T) {
+	if err := (Selectors{Title: "h2"}).Validate(); err == nil {
+		t.Error("expected missing item selector to be invalid")
+	}
+	if err := (Selectors{Item: "article", Date: "time:first-child"}).Validate(); err == nil {
+		t.Error("expected unsupported selector to be invalid")
+	}
+	if err := (Selectors{Item: "div.news > article", Link: "h2 a[href]"}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,17 +2,23 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/nkanaev/yarr/src/platform"
 	"github.com/nkanaev/yarr/src/server"
 	"github.com/nkanaev/yarr/src/storage"
+	"github.com/nkanaev/yarr/src/worker"
 )
 
 var Version string = "0.0"
@@ -48,7 +54,8 @@ func main() {
 	platform.FixConsoleIfNeeded()
 
 	var addr, db, authfile, auth, certfile, keyfile, basepath, logfile string
-	var ver, open bool
+	var useragent, proxy, timeout, connecttimeout, workers, hostworkers, retries, publicurl string
+	var ver, open, keepalive bool
 
 	flag.CommandLine.SetOutput(os.Stdout)
 
@@ -68,6 +75,15 @@ func main() {
 	flag.StringVar(&keyfile, "key-file", opt("YARR_KEYFILE", ""), "`path` to key file for https")
 	flag.StringVar(&db, "db", opt("YARR_DB", ""), "storage file `path`")
 	flag.StringVar(&logfile, "log-file", opt("YARR_LOGFILE", ""), "`path` to log file to use instead of stdout")
+	flag.StringVar(&useragent, "user-agent", opt("YARR_USER_AGENT", worker.DefaultConfig.UserAgent), "user agent for fetching feeds")
+	flag.StringVar(&proxy, "proxy", opt("YARR_PROXY", ""), "http(s):// or socks5:// proxy `url` for fetching feeds")
+	flag.StringVar(&timeout, "timeout", opt("YARR_TIMEOUT", worker.DefaultConfig.Timeout.String()), "feed fetching `duration` limit")
+	flag.StringVar(&connecttimeout, "connect-timeout", opt("YARR_CONNECT_TIMEOUT", worker.DefaultConfig.ConnectTimeout.String()), "connection `duration` limit")
+	flag.StringVar(&workers, "workers", opt("YARR_WORKERS", strconv.Itoa(worker.DefaultConfig.Workers)), "`number` of feeds fetched at once")
+	flag.StringVar(&hostworkers, "host-workers", opt("YARR_HOST_WORKERS", strconv.Itoa(worker.DefaultConfig.HostWorkers)), "`number` of feeds fetched at once from the same host")
+	flag.StringVar(&retries, "retries", opt("YARR_RETRIES", strconv.Itoa(worker.DefaultConfig.Retries)), "`number` of times a feed is fetched again after a network or server error")
+	flag.StringVar(&publicurl, "public-url", opt("YARR_PUBLIC_URL", ""), "`url` the service is reachable at from the internet (enables WebSub push subscriptions)")
+	flag.BoolVar(&keepalive, "keep-alive", opt("YARR_KEEP_ALIVE", "") == "true", "reuse connections when fetching feeds")
 	flag.BoolVar(&ver, "version", false, "print application version")
 	flag.BoolVar(&open, "open", false, "open the server in browser")
 	flag.Parse()
@@ -126,6 +142,32 @@ func main() {
 		log.Fatalf("Both cert & key files are required")
 	}
 
+	fetcher := worker.Config{
+		UserAgent:  useragent,
+		Proxy:      proxy,
+		KeepAlive:  keepalive,
+		PublicURL:  strings.TrimRight(publicurl, "/"),
+		RetryDelay: worker.DefaultConfig.RetryDelay,
+	}
+	if fetcher.Timeout, err = time.ParseDuration(timeout); err != nil {
+		log.Fatal("Invalid timeout: ", err)
+	}
+	if fetcher.ConnectTimeout, err = time.ParseDuration(connecttimeout); err != nil {
+		log.Fatal("Invalid connect timeout: ", err)
+	}
+	if fetcher.Workers, err = strconv.Atoi(workers); err != nil {
+		log.Fatal("Invalid number of workers: ", err)
+	}
+	if fetcher.HostWorkers, err = strconv.Atoi(hostworkers); err != nil {
+		log.Fatal("Invalid number of host workers: ", err)
+	}
+	if fetcher.Retries, err = strconv.Atoi(retries); err != nil {
+		log.Fatal("Invalid number of retries: ", err)
+	}
+	if err = worker.Configure(fetcher); err != nil {
+		log.Fatal("Invalid fetcher settings: ", err)
+	}
+
 	store, err := storage.New(db)
 	if err != nil {
 		log.Fatal("Failed to initialise database: ", err)
@@ -151,5 +193,12 @@ func main() {
 	if open {
 		platform.Open(srv.GetAddr())
 	}
-	platform.Start(srv)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	platform.Start(ctx, srv)
+
+	if err := store.Close(); err != nil {
+		log.Print("Failed to close database: ", err)
+	}
 }
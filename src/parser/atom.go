@@ -10,27 +10,40 @@ import (
 	"github.com/nkanaev/yarr/src/content/htmlutil"
 )
 
+const atomNS = "http://www.w3.org/2005/Atom"
+
 type atomFeed struct {
 	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
 	ID      string      `xml:"id"`
 	Title   atomText    `xml:"title"`
 	Links   atomLinks   `xml:"link"`
+	Icon    string      `xml:"icon"`
+	Logo    string      `xml:"logo"`
+	Authors atomPeople  `xml:"author"`
 	Entries []atomEntry `xml:"entry"`
 }
 
 type atomEntry struct {
-	ID        string    `xml:"id"`
-	Title     atomText  `xml:"title"`
-	Summary   atomText  `xml:"summary"`
-	Published string    `xml:"published"`
-	Updated   string    `xml:"updated"`
-	Links     atomLinks `xml:"link"`
-	Content   atomText  `xml:"http://www.w3.org/2005/Atom content"`
-	OrigLink  string    `xml:"http://rssnamespace.org/feedburner/ext/1.0 origLink"`
+	ID        string     `xml:"id"`
+	Title     atomText   `xml:"title"`
+	Summary   atomText   `xml:"summary"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Links     atomLinks  `xml:"link"`
+	Authors   atomPeople `xml:"author"`
+	Content   atomText   `xml:"http://www.w3.org/2005/Atom content"`
+	OrigLink  string     `xml:"http://rssnamespace.org/feedburner/ext/1.0 origLink"`
+
+	Categories []atomCategory `xml:"http://www.w3.org/2005/Atom category"`
 
 	media
 }
 
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
 type atomText struct {
 	Type string `xml:"type,attr"`
 	Data string `xml:",chardata"`
@@ -44,6 +57,12 @@ type atomLink struct {
 
 type atomLinks []atomLink
 
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomPeople []atomPerson
+
 func (a *atomText) Text() string {
 	if a.Type == "html" {
 		return htmlutil.ExtractText(a.Data)
@@ -68,6 +87,24 @@ func (links atomLinks) First(rel string) string {
 	return ""
 }
 
+func (people atomPeople) String() string {
+	names := make([]string, 0, len(people))
+	for _, p := range people {
+		if name := strings.TrimSpace(p.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func (e *atomEntry) categories() []string {
+	vals := make([]string, len(e.Categories))
+	for i, c := range e.Categories {
+		vals[i] = firstNonEmpty(c.Label, c.Term)
+	}
+	return categories(vals...)
+}
+
 func ParseAtom(r io.Reader) (*Feed, error) {
 	srcfeed := atomFeed{}
 
@@ -79,6 +116,10 @@ func ParseAtom(r io.Reader) (*Feed, error) {
 	dstfeed := &Feed{
 		Title:   srcfeed.Title.String(),
 		SiteURL: firstNonEmpty(srcfeed.Links.First("alternate"), srcfeed.Links.First("")),
+		HubURL:  srcfeed.Links.First("hub"),
+		SelfURL: srcfeed.Links.First("self"),
+		IconURL: strings.TrimSpace(srcfeed.Icon),
+		LogoURL: strings.TrimSpace(srcfeed.Logo),
 	}
 	for _, srcitem := range srcfeed.Entries {
 		linkFromID := ""
@@ -94,9 +135,12 @@ func ParseAtom(r io.Reader) (*Feed, error) {
 			Date:     dateParse(firstNonEmpty(srcitem.Published, srcitem.Updated)),
 			URL:      link,
 			Title:    srcitem.Title.Text(),
+			Author:   firstNonEmpty(srcitem.Authors.String(), srcfeed.Authors.String()),
 			Content:  firstNonEmpty(srcitem.Content.String(), srcitem.Summary.String(), srcitem.firstMediaDescription()),
 			ImageURL: srcitem.firstMediaThumbnail(),
 			AudioURL: "",
+
+			Categories: srcitem.categories(),
 		})
 	}
 	return dstfeed, nil
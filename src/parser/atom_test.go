@@ -38,12 +38,14 @@ func TestAtom(t *testing.T) {
 	want := &Feed{
 		Title:   "Example Feed",
 		SiteURL: "http://example.org/",
+		SelfURL: "http://example.org/feed/",
 		Items: []Item{
 			{
 				GUID:     "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a",
 				Date:     time.Unix(1071340202, 0).UTC(),
 				URL:      "http://example.org/2003/12/13/atom03.html",
 				Title:    "Atom-Powered Robots Run Amok",
+				Author:   "John Doe",
 				Content:  `<div xmlns="http://www.w3.org/1999/xhtml"><p>This is the entry content.</p></div>`,
 				ImageURL: "",
 				AudioURL: "",
@@ -57,6 +59,30 @@ func TestAtom(t *testing.T) {
 	}
 }
 
+func TestAtomAuthor(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="utf-8"?>
+		<feed xmlns="http://www.w3.org/2005/Atom">
+			<author><name>Feed Author</name></author>
+			<entry>
+				<title>one</title>
+				<author><name>Jane Doe</name></author>
+				<author><name>John Doe</name></author>
+			</entry>
+			<entry>
+				<title>two</title>
+			</entry>
+		</feed>
+	`))
+	have := []string{feed.Items[0].Author, feed.Items[1].Author}
+	want := []string{"Jane Doe, John Doe", "Feed Author"}
+	if !reflect.DeepEqual(want, have) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.FailNow()
+	}
+}
+
 func TestAtomClashingNamespaces(t *testing.T) {
 	have, err := Parse(strings.NewReader(`
 		<?xml version="1.0" encoding="utf-8"?>
@@ -154,25 +180,68 @@ func TestAtomLinkInID(t *testing.T) {
 	have := feed.Items
 	want := []Item{
 		Item{
-			GUID:     "https://example.com/posts/1::2003-12-13T09:17:51",
-			Date:     time.Date(2003, time.December, 13, 9, 17, 51, 0, time.UTC),
-			URL:      "https://example.com/posts/1",
-			Title:    "one updated",
-        },
+			GUID:  "https://example.com/posts/1::2003-12-13T09:17:51",
+			Date:  time.Date(2003, time.December, 13, 9, 17, 51, 0, time.UTC),
+			URL:   "https://example.com/posts/1",
+			Title: "one updated",
+		},
 		Item{
 			GUID: "urn:uuid:60a76c80-d399-11d9-b93C-0003939e0af6",
-            Date: time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC), URL: "",
-            Title: "two",
-        },
-        Item{
-            GUID: "https://example.com/posts/1::",
-            Date: time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC),
-            URL: "https://example.com/posts/1",
-            Title: "one",
-            Content: "",
-        },
+			Date: time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC), URL: "",
+			Title: "two",
+		},
+		Item{
+			GUID:    "https://example.com/posts/1::",
+			Date:    time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC),
+			URL:     "https://example.com/posts/1",
+			Title:   "one",
+			Content: "",
+		},
 	}
 	if !reflect.DeepEqual(want, have) {
 		t.Fatalf("\nwant: %#v\nhave: %#v\n", want, have)
 	}
 }
+
+func TestAtomWebSub(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="utf-8"?>
+		<feed xmlns="http://www.w3.org/2005/Atom">
+			<link rel="alternate" href="http://example.org/"/>
+			<link rel="hub" href="http://hub.example.org/"/>
+			<link rel="self" href="http://example.org/feed.atom"/>
+		</feed>
+	`))
+	if feed.HubURL != "http://hub.example.org/" || feed.SelfURL != "http://example.org/feed.atom" {
+		t.Fatalf("invalid websub links: %q, %q", feed.HubURL, feed.SelfURL)
+	}
+}
+
+func TestAtomCategories(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="utf-8"?>
+		<feed xmlns="http://www.w3.org/2005/Atom">
+			<entry>
+				<id>1</id>
+				<category term="go" label="Go"/>
+				<category term="sqlite"/>
+			</entry>
+		</feed>
+	`))
+	if want := []string{"Go", "sqlite"}; !reflect.DeepEqual(feed.Items[0].Categories, want) {
+		t.Fatalf("invalid categories\nwant: %#v\nhave: %#v", want, feed.Items[0].Categories)
+	}
+}
+
+func TestAtomIcons(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="utf-8"?>
+		<feed xmlns="http://www.w3.org/2005/Atom">
+			<icon> http://example.org/favicon.png </icon>
+			<logo>http://example.org/logo.png</logo>
+		</feed>
+	`))
+	if feed.IconURL != "http://example.org/favicon.png" || feed.LogoURL != "http://example.org/logo.png" {
+		t.Fatalf("invalid icons: %q, %q", feed.IconURL, feed.LogoURL)
+	}
+}
@@ -130,6 +130,7 @@ func (feed *Feed) cleanup() {
 		feed.Items[i].GUID = strings.TrimSpace(item.GUID)
 		feed.Items[i].URL = strings.TrimSpace(item.URL)
 		feed.Items[i].Title = strings.TrimSpace(htmlutil.ExtractText(item.Title))
+		feed.Items[i].Author = strings.TrimSpace(item.Author)
 		feed.Items[i].Content = strings.TrimSpace(item.Content)
 
 		if item.ImageURL != "" && strings.Contains(item.Content, item.ImageURL) {
@@ -159,6 +160,14 @@ func (feed *Feed) TranslateURLs(base string) error {
 		return fmt.Errorf("failed to parse feed url: %#v", feed.SiteURL)
 	}
 	feed.SiteURL = baseUrl.ResolveReference(siteUrl).String()
+	for _, link := range []*string{&feed.HubURL, &feed.SelfURL, &feed.IconURL, &feed.LogoURL} {
+		if *link == "" {
+			continue
+		}
+		if u, err := url.Parse(*link); err == nil {
+			*link = baseUrl.ResolveReference(u).String()
+		}
+	}
 	for _, item := range feed.Items {
 		itemUrl, err := url.Parse(item.URL)
 		if err != nil {
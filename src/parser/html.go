@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+	"github.com/nkanaev/yarr/src/content/scraper"
+	"golang.org/x/net/html/charset"
+)
+
+// ParseHTML makes up the feed from the page without one, using the selectors.
+// Items without a link are identified by their title.
+func ParseHTML(r io.Reader, baseURL, fallbackEncoding string, selectors scraper.Selectors) (*Feed, error) {
+	contentType := "text/html"
+	if fallbackEncoding != "" {
+		contentType += "; charset=" + fallbackEncoding
+	}
+	r, err := charset.NewReader(r, contentType)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	title, items, err := scraper.FindItems(string(body), selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &Feed{Title: title, SiteURL: baseURL}
+	for _, item := range items {
+		link := item.Link
+		if link != "" {
+			link = htmlutil.AbsoluteUrl(strings.TrimSpace(link), baseURL)
+		}
+		feed.Items = append(feed.Items, Item{
+			URL:     link,
+			Title:   item.Title,
+			Date:    dateParse(item.Date),
+			Content: item.Content,
+		})
+	}
+	feed.cleanup()
+	feed.SetMissingDatesTo(time.Now())
+	for i, item := range feed.Items {
+		feed.Items[i].GUID = firstNonEmpty(item.URL, item.Title)
+	}
+	return feed, nil
+}
@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nkanaev/yarr/src/content/scraper"
+)
+
+func TestParseHTML(t *testing.T) {
+	feed, err := ParseHTML(strings.NewReader(`
+		<html>
+		<head><title>Blog</title></head>
+		<body>
+			<ul>
+				<li><a href="/posts/1">One</a> <span>2021-03-04</span></li>
+				<li><a href="https://example.org/posts/2">Two</a></li>
+			</ul>
+		</body>
+		</html>
+	`), "https://example.com/blog/", "", scraper.Selectors{Item: "li", Date: "span"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Blog" || feed.SiteURL != "https://example.com/blog/" || len(feed.Items) != 2 {
+		t.Fatalf("invalid feed: %#v", feed)
+	}
+	one, two := feed.Items[0], feed.Items[1]
+	if one.GUID != "https://example.com/posts/1" || one.URL != one.GUID || one.Title != "One" {
+		t.Errorf("invalid item: %#v", one)
+	}
+	if !one.Date.Equal(time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("invalid date: %s", one.Date)
+	}
+	if two.URL != "https://example.org/posts/2" || two.Date.IsZero() {
+		t.Errorf("invalid item: %#v", two)
+	}
+}
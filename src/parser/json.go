@@ -4,13 +4,20 @@ package parser
 import (
 	"encoding/json"
 	"io"
+	"strings"
 )
 
 type jsonFeed struct {
-	Version string     `json:"version"`
-	Title   string     `json:"title"`
-	SiteURL string     `json:"home_page_url"`
-	Items   []jsonItem `json:"items"`
+	Version string       `json:"version"`
+	Title   string       `json:"title"`
+	SiteURL string       `json:"home_page_url"`
+	FeedURL string       `json:"feed_url"`
+	Icon    string       `json:"icon"`
+	Favicon string       `json:"favicon"`
+	Hubs    []jsonHub    `json:"hubs"`
+	Author  *jsonAuthor  `json:"author"`
+	Authors []jsonAuthor `json:"authors"`
+	Items   []jsonItem   `json:"items"`
 }
 
 type jsonItem struct {
@@ -22,7 +29,20 @@ type jsonItem struct {
 	HTML          string           `json:"content_html"`
 	DatePublished string           `json:"date_published"`
 	DateModified  string           `json:"date_modified"`
+	Author        *jsonAuthor      `json:"author"`
+	Authors       []jsonAuthor     `json:"authors"`
 	Attachments   []jsonAttachment `json:"attachments"`
+	Tags          []string         `json:"tags"`
+}
+
+type jsonHub struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
 }
 
 type jsonAttachment struct {
@@ -33,6 +53,30 @@ type jsonAttachment struct {
 	Duration int    `json:"duration_in_seconds"`
 }
 
+// jsonAuthors returns the names listed in `authors` (version 1.1),
+// falling back to the deprecated `author` object (version 1.0).
+func jsonAuthors(author *jsonAuthor, authors []jsonAuthor) string {
+	if len(authors) == 0 && author != nil {
+		authors = []jsonAuthor{*author}
+	}
+	names := make([]string, 0, len(authors))
+	for _, a := range authors {
+		if name := strings.TrimSpace(a.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func (f *jsonFeed) hubURL() string {
+	for _, hub := range f.Hubs {
+		if strings.EqualFold(hub.Type, "websub") {
+			return hub.URL
+		}
+	}
+	return ""
+}
+
 func ParseJSON(data io.Reader) (*Feed, error) {
 	srcfeed := new(jsonFeed)
 	decoder := json.NewDecoder(data)
@@ -43,14 +87,22 @@ func ParseJSON(data io.Reader) (*Feed, error) {
 	dstfeed := &Feed{
 		Title:   srcfeed.Title,
 		SiteURL: srcfeed.SiteURL,
+		SelfURL: srcfeed.FeedURL,
+		HubURL:  srcfeed.hubURL(),
+		IconURL: srcfeed.Favicon,
+		LogoURL: srcfeed.Icon,
 	}
+	feedAuthor := jsonAuthors(srcfeed.Author, srcfeed.Authors)
 	for _, srcitem := range srcfeed.Items {
 		dstfeed.Items = append(dstfeed.Items, Item{
 			GUID:    firstNonEmpty(srcitem.ID, srcitem.URL),
 			Date:    dateParse(firstNonEmpty(srcitem.DatePublished, srcitem.DateModified)),
 			URL:     srcitem.URL,
 			Title:   srcitem.Title,
+			Author:  firstNonEmpty(jsonAuthors(srcitem.Author, srcitem.Authors), feedAuthor),
 			Content: firstNonEmpty(srcitem.HTML, srcitem.Text, srcitem.Summary),
+
+			Categories: categories(srcitem.Tags...),
 		})
 	}
 	return dstfeed, nil
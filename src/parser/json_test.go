@@ -28,6 +28,7 @@ func TestJSONFeed(t *testing.T) {
 	want := &Feed{
 		Title:   "My Example Feed",
 		SiteURL: "https://example.org/",
+		SelfURL: "https://example.org/feed.json",
 		Items: []Item{
 			{GUID: "2", Content: "This is a second item.", URL: "https://example.org/second-item"},
 			{GUID: "1", Content: "<p>Hello, world!</p>", URL: "https://example.org/initial-post"},
@@ -40,3 +41,46 @@ func TestJSONFeed(t *testing.T) {
 		t.Fatal("invalid json")
 	}
 }
+
+func TestJSONFeedAuthor(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`{
+		"version": "https://jsonfeed.org/version/1.1",
+		"authors": [{"name": "Feed Author"}],
+		"items": [
+			{"id": "1", "author": {"name": "John Doe"}},
+			{"id": "2", "authors": [{"name": "Jane Doe"}, {"name": "John Doe"}]},
+			{"id": "3"}
+		]
+	}`))
+	have := []string{feed.Items[0].Author, feed.Items[1].Author, feed.Items[2].Author}
+	want := []string{"John Doe", "Jane Doe, John Doe", "Feed Author"}
+	if !reflect.DeepEqual(want, have) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fatal("invalid author")
+	}
+}
+
+func TestJSONFeedHubs(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`{
+		"version": "https://jsonfeed.org/version/1.1",
+		"feed_url": "https://example.org/feed.json",
+		"hubs": [{"type": "rssCloud", "url": "https://cloud.example.org/"}, {"type": "WebSub", "url": "https://hub.example.org/"}],
+		"items": []
+	}`))
+	if feed.HubURL != "https://hub.example.org/" || feed.SelfURL != "https://example.org/feed.json" {
+		t.Fatalf("invalid websub links: %q, %q", feed.HubURL, feed.SelfURL)
+	}
+}
+
+func TestJSONFeedIcons(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`{
+		"version": "https://jsonfeed.org/version/1.1",
+		"icon": "https://example.org/icon.png",
+		"favicon": "https://example.org/favicon.png",
+		"items": []
+	}`))
+	if feed.IconURL != "https://example.org/favicon.png" || feed.LogoURL != "https://example.org/icon.png" {
+		t.Fatalf("invalid icons: %q, %q", feed.IconURL, feed.LogoURL)
+	}
+}
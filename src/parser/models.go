@@ -6,15 +6,32 @@ type Feed struct {
 	Title   string
 	SiteURL string
 	Items   []Item
+
+	// How long the feed may be cached before refreshing (`<ttl>` or `sy:updatePeriod`),
+	// and the hours (GMT) & days it shouldn't be refreshed at.
+	TTL       time.Duration
+	SkipHours []int
+	SkipDays  []time.Weekday
+
+	// WebSub hub & the feed's canonical url to subscribe to
+	HubURL  string
+	SelfURL string
+
+	// the feed's small square icon & its larger image
+	IconURL string
+	LogoURL string
 }
 
 type Item struct {
-	GUID  string
-	Date  time.Time
-	URL   string
-	Title string
+	GUID   string
+	Date   time.Time
+	URL    string
+	Title  string
+	Author string
 
 	Content  string
 	ImageURL string
 	AudioURL string
+
+	Categories []string
 }
@@ -13,6 +13,8 @@ type rdfFeed struct {
 	Title   string    `xml:"channel>title"`
 	Link    string    `xml:"channel>link"`
 	Items   []rdfItem `xml:"item"`
+
+	syndication
 }
 
 type rdfItem struct {
@@ -20,8 +22,9 @@ type rdfItem struct {
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
 
-	DublinCoreDate string `xml:"http://purl.org/dc/elements/1.1/ date"`
-	ContentEncoded string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	DublinCoreDate    string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	DublinCoreCreator string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	ContentEncoded    string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
 }
 
 func ParseRDF(r io.Reader) (*Feed, error) {
@@ -35,6 +38,7 @@ func ParseRDF(r io.Reader) (*Feed, error) {
 	dstfeed := &Feed{
 		Title:   srcfeed.Title,
 		SiteURL: srcfeed.Link,
+		TTL:     srcfeed.updateInterval(),
 	}
 	for _, srcitem := range srcfeed.Items {
 		dstfeed.Items = append(dstfeed.Items, Item{
@@ -42,6 +46,7 @@ func ParseRDF(r io.Reader) (*Feed, error) {
 			URL:     srcitem.Link,
 			Date:    dateParse(srcitem.DublinCoreDate),
 			Title:   srcitem.Title,
+			Author:  srcitem.DublinCoreCreator,
 			Content: firstNonEmpty(srcitem.ContentEncoded, srcitem.Description),
 		})
 	}
@@ -79,3 +79,20 @@ func TestRDFExtensions(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestRDFSyndicationHints(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="utf-8"?>
+		<rdf:RDF xmlns="http://purl.org/rss/1.0/"
+				xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+				xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+			<channel>
+				<title>hourly</title>
+				<sy:updatePeriod>hourly</sy:updatePeriod>
+			</channel>
+		</rdf:RDF>
+	`))
+	if feed.TTL != time.Hour {
+		t.Errorf("invalid ttl: %s", feed.TTL)
+	}
+}
@@ -15,8 +15,11 @@ type rssFeed struct {
 	XMLName xml.Name  `xml:"rss"`
 	Version string    `xml:"version,attr"`
 	Title   string    `xml:"channel>title"`
-	Link    string    `xml:"channel>link"`
+	Links   []rssLink `xml:"channel>link"`
+	Image   string    `xml:"channel>image>url"`
 	Items   []rssItem `xml:"channel>item"`
+
+	rssHints
 }
 
 type rssItem struct {
@@ -25,10 +28,13 @@ type rssItem struct {
 	Link        string         `xml:"rss link"`
 	Description string         `xml:"rss description"`
 	PubDate     string         `xml:"pubDate"`
+	Author      string         `xml:"rss author"`
 	Enclosures  []rssEnclosure `xml:"enclosure"`
+	Categories  []string       `xml:"rss category"`
 
-	DublinCoreDate string `xml:"http://purl.org/dc/elements/1.1/ date"`
-	ContentEncoded string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	DublinCoreDate    string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	DublinCoreCreator string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	ContentEncoded    string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
 
 	OrigLink          string `xml:"http://rssnamespace.org/feedburner/ext/1.0 origLink"`
 	OrigEnclosureLink string `xml:"http://rssnamespace.org/feedburner/ext/1.0 origEnclosureLink"`
@@ -60,6 +66,25 @@ type rssEnclosure struct {
 	Length string `xml:"length,attr"`
 }
 
+// siteURL picks the channel's own link among the `atom:link`s.
+func (f *rssFeed) siteURL() string {
+	for _, link := range f.Links {
+		if link.XMLName.Space != atomNS && link.Data != "" {
+			return link.Data
+		}
+	}
+	return ""
+}
+
+func (f *rssFeed) atomLink(rel string) string {
+	for _, link := range f.Links {
+		if link.XMLName.Space == atomNS && link.Rel == rel {
+			return link.Href
+		}
+	}
+	return ""
+}
+
 func ParseRSS(r io.Reader) (*Feed, error) {
 	srcfeed := rssFeed{}
 
@@ -71,8 +96,12 @@ func ParseRSS(r io.Reader) (*Feed, error) {
 
 	dstfeed := &Feed{
 		Title:   srcfeed.Title,
-		SiteURL: srcfeed.Link,
+		SiteURL: srcfeed.siteURL(),
+		HubURL:  srcfeed.atomLink("hub"),
+		SelfURL: srcfeed.atomLink("self"),
+		LogoURL: strings.TrimSpace(srcfeed.Image),
 	}
+	srcfeed.rssHints.apply(dstfeed)
 	for _, srcitem := range srcfeed.Items {
 		podcastURL := ""
 		for _, e := range srcitem.Enclosures {
@@ -96,9 +125,12 @@ func ParseRSS(r io.Reader) (*Feed, error) {
 			Date:     dateParse(firstNonEmpty(srcitem.DublinCoreDate, srcitem.PubDate)),
 			URL:      firstNonEmpty(srcitem.OrigLink, srcitem.Link, permalink),
 			Title:    srcitem.Title,
+			Author:   firstNonEmpty(srcitem.DublinCoreCreator, srcitem.Author),
 			Content:  firstNonEmpty(srcitem.ContentEncoded, srcitem.Description),
 			AudioURL: podcastURL,
 			ImageURL: srcitem.firstMediaThumbnail(),
+
+			Categories: categories(srcitem.Categories...),
 		})
 	}
 	return dstfeed, nil
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRSSFeed(t *testing.T) {
@@ -204,6 +205,29 @@ func TestRSSTitleHTMLTags(t *testing.T) {
 	}
 }
 
+func TestRSSAuthor(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="UTF-8"?>
+		<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+			<channel>
+				<item>
+					<author>john@example.com (John Doe)</author>
+				</item>
+				<item>
+					<dc:creator>Jane Doe</dc:creator>
+				</item>
+			</channel>
+		</rss>
+	`))
+	have := []string{feed.Items[0].Author, feed.Items[1].Author}
+	want := []string{"john@example.com (John Doe)", "Jane Doe"}
+	for i := 0; i < len(want); i++ {
+		if want[i] != have[i] {
+			t.Errorf("author doesn't match\nwant: %#v\nhave: %#v\n", want[i], have[i])
+		}
+	}
+}
+
 func TestRSSIsPermalink(t *testing.T) {
 	feed, _ := Parse(strings.NewReader(`
 		<?xml version="1.0" encoding="UTF-8"?>
@@ -223,8 +247,105 @@ func TestRSSIsPermalink(t *testing.T) {
 		},
 	}
 	for i := 0; i < len(want); i++ {
-		if want[i] != have[i] {
+		if !reflect.DeepEqual(want[i], have[i]) {
 			t.Errorf("Failed to handle isPermalink\nwant: %#v\nhave: %#v\n", want[i], have[i])
 		}
 	}
 }
+
+func TestRSSRefreshHints(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="UTF-8"?>
+		<rss version="2.0">
+			<channel>
+				<ttl>90</ttl>
+				<skipHours><hour>0</hour><hour>24</hour><hour>7</hour></skipHours>
+				<skipDays><day>Saturday</day><day>sunday</day><day>caturday</day></skipDays>
+			</channel>
+		</rss>
+	`))
+	if feed.TTL != 90*time.Minute {
+		t.Errorf("invalid ttl: %s", feed.TTL)
+	}
+	if want := []int{0, 0, 7}; !reflect.DeepEqual(feed.SkipHours, want) {
+		t.Errorf("skip hours don't match\nwant: %#v\nhave: %#v", want, feed.SkipHours)
+	}
+	if want := []time.Weekday{time.Saturday, time.Sunday}; !reflect.DeepEqual(feed.SkipDays, want) {
+		t.Errorf("skip days don't match\nwant: %#v\nhave: %#v", want, feed.SkipDays)
+	}
+}
+
+func TestRSSSyndicationHints(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="UTF-8"?>
+		<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+			<channel>
+				<ttl>60</ttl>
+				<sy:updatePeriod>daily</sy:updatePeriod>
+				<sy:updateFrequency>4</sy:updateFrequency>
+			</channel>
+		</rss>
+	`))
+	if feed.TTL != 6*time.Hour {
+		t.Errorf("invalid ttl: %s", feed.TTL)
+	}
+}
+
+func TestRSSWebSub(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="UTF-8"?>
+		<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+			<channel>
+				<link>http://example.com/</link>
+				<atom:link rel="hub" href="http://hub.example.com/" />
+				<atom:link rel="self" href="http://example.com/feed.xml" type="application/rss+xml" />
+			</channel>
+		</rss>
+	`))
+	have := []string{feed.SiteURL, feed.HubURL, feed.SelfURL}
+	want := []string{"http://example.com/", "http://hub.example.com/", "http://example.com/feed.xml"}
+	if !reflect.DeepEqual(want, have) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fatal("invalid websub links")
+	}
+}
+
+func TestRSSCategories(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="UTF-8"?>
+		<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/">
+			<channel>
+				<item>
+					<guid>1</guid>
+					<category> Go </category>
+					<category domain="http://example.com/tags">sqlite</category>
+					<category></category>
+					<media:category>ignored</media:category>
+				</item>
+			</channel>
+		</rss>
+	`))
+	if want := []string{"Go", "sqlite"}; !reflect.DeepEqual(feed.Items[0].Categories, want) {
+		t.Fatalf("invalid categories\nwant: %#v\nhave: %#v", want, feed.Items[0].Categories)
+	}
+}
+
+func TestRSSImage(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="UTF-8"?>
+		<rss version="2.0">
+			<channel>
+				<image>
+					<url>http://example.com/logo.png</url>
+					<title>Example</title>
+					<link>http://example.com/</link>
+				</image>
+				<item><guid>1</guid></item>
+			</channel>
+		</rss>
+	`))
+	if feed.LogoURL != "http://example.com/logo.png" {
+		t.Fatalf("invalid image: %q", feed.LogoURL)
+	}
+}
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Refresh hints found in the RSS channel.
+// see: https://www.rssboard.org/rss-specification#optionalChannelElements
+type rssHints struct {
+	TTL       string   `xml:"channel>ttl"`
+	SkipHours []string `xml:"channel>skipHours>hour"`
+	SkipDays  []string `xml:"channel>skipDays>day"`
+
+	syndication
+}
+
+// see: https://web.resource.org/rss/1.0/modules/syndication/
+type syndication struct {
+	UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ channel>updatePeriod"`
+	UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ channel>updateFrequency"`
+}
+
+var syndicationPeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   time.Hour * 24,
+	"weekly":  time.Hour * 24 * 7,
+	"monthly": time.Hour * 24 * 30,
+	"yearly":  time.Hour * 24 * 365,
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func (s syndication) updateInterval() time.Duration {
+	period, ok := syndicationPeriods[strings.ToLower(strings.TrimSpace(s.UpdatePeriod))]
+	if !ok {
+		if strings.TrimSpace(s.UpdateFrequency) == "" {
+			return 0
+		}
+		// the period defaults to daily if only the frequency is present
+		period = syndicationPeriods["daily"]
+	}
+	frequency, err := strconv.Atoi(strings.TrimSpace(s.UpdateFrequency))
+	if err != nil || frequency < 1 {
+		frequency = 1
+	}
+	return period / time.Duration(frequency)
+}
+
+func (h rssHints) apply(feed *Feed) {
+	if minutes, err := strconv.Atoi(strings.TrimSpace(h.TTL)); err == nil && minutes > 0 {
+		feed.TTL = time.Minute * time.Duration(minutes)
+	}
+	if interval := h.updateInterval(); interval > feed.TTL {
+		feed.TTL = interval
+	}
+	for _, text := range h.SkipHours {
+		hour, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil || hour < 0 || hour > 24 {
+			continue
+		}
+		// some feeds count hours from 1 to 24
+		feed.SkipHours = append(feed.SkipHours, hour%24)
+	}
+	for _, text := range h.SkipDays {
+		if day, ok := weekdays[strings.ToLower(strings.TrimSpace(text))]; ok {
+			feed.SkipDays = append(feed.SkipDays, day)
+		}
+	}
+}
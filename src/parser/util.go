@@ -21,6 +21,17 @@ func firstNonEmpty(vals ...string) string {
 	return ""
 }
 
+// categories trims the values & drops the empty ones (nil, if none left).
+func categories(vals ...string) []string {
+	var result []string
+	for _, val := range vals {
+		if val = strings.TrimSpace(val); val != "" {
+			result = append(result, val)
+		}
+	}
+	return result
+}
+
 var linkRe = regexp.MustCompile(`(https?:\/\/\S+)`)
 
 func plain2html(text string) string {
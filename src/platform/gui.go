@@ -4,11 +4,14 @@
 package platform
 
 import (
+	"context"
+
 	"github.com/nkanaev/yarr/src/server"
 	"github.com/nkanaev/yarr/src/systray"
 )
 
-func Start(s *server.Server) {
+func Start(ctx context.Context, s *server.Server) {
+	ctx, quit := context.WithCancel(ctx)
 	systrayOnReady := func() {
 		systray.SetIcon(Icon)
 
@@ -22,12 +25,13 @@ func Start(s *server.Server) {
 				case <-menuOpen.ClickedCh:
 					Open(s.GetAddr())
 				case <-menuQuit.ClickedCh:
-					systray.Quit()
+					quit()
 				}
 			}
 		}()
 
-		s.Start()
+		s.Start(ctx)
+		systray.Quit()
 	}
 	systray.Run(systrayOnReady, nil)
 }
@@ -4,9 +4,11 @@
 package platform
 
 import (
+	"context"
+
 	"github.com/nkanaev/yarr/src/server"
 )
 
-func Start(s *server.Server) {
-	s.Start()
+func Start(ctx context.Context, s *server.Server) {
+	s.Start(ctx)
 }
@@ -226,9 +226,15 @@ func (s *Server) feverFaviconsHandler(c *router.Context) {
 const listLimit = 50
 
 func (s *Server) feverItemsHandler(c *router.Context) {
-	filter := storage.ItemFilter{}
 	query := c.Req.URL.Query()
 
+	// non-standard extension: same search syntax as in the web api
+	filter, err := storage.ParseQuery(query.Get("search"))
+	if err != nil {
+		writeQueryError(c, err)
+		return
+	}
+
 	switch {
 	case query.Get("with_ids") != "":
 		ids := make([]int64, 0)
@@ -258,18 +264,18 @@ func (s *Server) feverItemsHandler(c *router.Context) {
 		time := date.Unix()
 
 		isSaved := 0
-		if item.Status == storage.STARRED {
+		if item.IsStarred {
 			isSaved = 1
 		}
 		isRead := 0
-		if item.Status == storage.READ {
+		if item.IsRead {
 			isRead = 1
 		}
 		feverItems[i] = FeverItem{
 			ID:        item.Id,
 			FeedID:    item.FeedId,
 			Title:     item.Title,
-			Author:    "",
+			Author:    item.Author,
 			HTML:      item.Content,
 			Url:       item.Link,
 			IsSaved:   isSaved,
@@ -293,11 +299,11 @@ func (s *Server) feverLinksHandler(c *router.Context) {
 }
 
 func (s *Server) feverUnreadItemIDsHandler(c *router.Context) {
-	status := storage.UNREAD
+	isRead := false
 	itemIds := make([]int64, 0)
 
 	itemFilter := storage.ItemFilter{
-		Status: &status,
+		IsRead: &isRead,
 	}
 	for {
 		items := s.db.ListItems(itemFilter, listLimit, true, false)
@@ -315,11 +321,11 @@ func (s *Server) feverUnreadItemIDsHandler(c *router.Context) {
 }
 
 func (s *Server) feverSavedItemIDsHandler(c *router.Context) {
-	status := storage.STARRED
+	isStarred := true
 	itemIds := make([]int64, 0)
 
 	itemFilter := storage.ItemFilter{
-		Status: &status,
+		IsStarred: &isStarred,
 	}
 	for {
 		items := s.db.ListItems(itemFilter, listLimit, true, false)
@@ -345,21 +351,19 @@ func (s *Server) feverMarkHandler(c *router.Context) {
 
 	switch c.Req.Form.Get("mark") {
 	case "item":
-		var status storage.ItemStatus
 		switch c.Req.Form.Get("as") {
 		case "read":
-			status = storage.READ
+			s.db.UpdateItemRead(id, true)
 		case "unread":
-			status = storage.UNREAD
+			s.db.UpdateItemRead(id, false)
 		case "saved":
-			status = storage.STARRED
+			s.db.UpdateItemStarred(id, true)
 		case "unsaved":
-			status = storage.READ
+			s.db.UpdateItemStarred(id, false)
 		default:
 			c.Out.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		s.db.UpdateItemStatus(id, status)
 	case "feed":
 		if c.Req.Form.Get("as") != "read" {
 			c.Out.WriteHeader(http.StatusBadRequest)
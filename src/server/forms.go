@@ -1,21 +1,131 @@
 package server
 
-import "github.com/nkanaev/yarr/src/storage"
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/nkanaev/yarr/src/content/rewrite"
+	"github.com/nkanaev/yarr/src/content/scraper"
+	"github.com/nkanaev/yarr/src/storage"
+)
 
 type ItemUpdateForm struct {
-	Status *storage.ItemStatus `json:"status,omitempty"`
+	IsRead    *bool    `json:"is_read,omitempty"`
+	IsStarred *bool    `json:"is_starred,omitempty"`
+	Labels    *[]int64 `json:"labels,omitempty"`
 }
 
 type FolderCreateForm struct {
+	Title    string `json:"title"`
+	ParentID *int64 `json:"parent_id,omitempty"`
+}
+
+type FeedCreateForm struct {
+	Url      string             `json:"url"`
+	FolderID *int64             `json:"folder_id,omitempty"`
+	Scraper  *scraper.Selectors `json:"scraper,omitempty"`
+}
+
+type LabelCreateForm struct {
 	Title string `json:"title"`
 }
 
-type FolderUpdateForm struct {
-	Title      *string `json:"title,omitempty"`
-	IsExpanded *bool   `json:"is_expanded,omitempty"`
+type LabelUpdateForm struct {
+	Title *string `json:"title,omitempty"`
 }
 
-type FeedCreateForm struct {
-	Url      string `json:"url"`
+type SmartFolderForm struct {
+	Title    string `json:"title"`
+	Query    string `json:"query"`
+	FeedID   *int64 `json:"feed_id,omitempty"`
 	FolderID *int64 `json:"folder_id,omitempty"`
 }
+
+type RuleForm struct {
+	Title          string `json:"title"`
+	FeedID         *int64 `json:"feed_id,omitempty"`
+	FolderID       *int64 `json:"folder_id,omitempty"`
+	Field          string `json:"field"`
+	Match          string `json:"match"`
+	Pattern        string `json:"pattern"`
+	Action         string `json:"action"`
+	LabelID        *int64 `json:"label_id,omitempty"`
+	TargetFolderID *int64 `json:"target_folder_id,omitempty"`
+	Enabled        *bool  `json:"enabled,omitempty"`
+}
+
+// rule converts the form into a rule. Rules are enabled unless stated otherwise.
+func (f RuleForm) rule() storage.Rule {
+	return storage.Rule{
+		Title:          f.Title,
+		FeedId:         f.FeedID,
+		FolderId:       f.FolderID,
+		Field:          f.Field,
+		Match:          f.Match,
+		Pattern:        f.Pattern,
+		Action:         f.Action,
+		LabelId:        f.LabelID,
+		TargetFolderId: f.TargetFolderID,
+		Enabled:        f.Enabled == nil || *f.Enabled,
+	}
+}
+
+// parseRetentionPolicy converts the decoded `retention` field of a feed/folder update
+// into a policy. `null` (or a missing key) resets the value to the inherited one.
+func parseRetentionPolicy(val interface{}) (storage.RetentionPolicy, error) {
+	var policy storage.RetentionPolicy
+	if val == nil {
+		return policy, nil
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return policy, err
+	}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return policy, errors.New("Invalid retention policy.")
+	}
+	if !policy.IsValid() {
+		return policy, errors.New("Retention values must not be negative.")
+	}
+	return policy, nil
+}
+
+// parseScraper converts the decoded `scraper` field of a feed update
+// into the selectors. `null` turns the scraping off.
+func parseScraper(val interface{}) (*scraper.Selectors, error) {
+	if val == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	var selectors scraper.Selectors
+	if err := json.Unmarshal(data, &selectors); err != nil {
+		return nil, errors.New("Invalid scraper.")
+	}
+	if err := selectors.Validate(); err != nil {
+		return nil, errors.New("Invalid scraper: " + err.Error())
+	}
+	return &selectors, nil
+}
+
+// parseRewrite converts the decoded `rewrite` field of a feed update
+// into the pipeline. `null` (or an empty list) turns the rewriting off.
+func parseRewrite(val interface{}) (rewrite.Pipeline, error) {
+	if val == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	var pipeline rewrite.Pipeline
+	if err := json.Unmarshal(data, &pipeline); err != nil {
+		return nil, errors.New("Invalid rewrite steps.")
+	}
+	if err := pipeline.Validate(); err != nil {
+		return nil, errors.New("Invalid rewrite step: " + err.Error())
+	}
+	return pipeline, nil
+}
@@ -27,6 +27,15 @@ func (rw *gzipResponseWriter) WriteHeader(statusCode int) {
 	rw.src.WriteHeader(statusCode)
 }
 
+// Flush pushes out the data compressed so far, so that streamed responses
+// (such as server-sent events) reach the client right away.
+func (rw *gzipResponseWriter) Flush() {
+	rw.out.Flush()
+	if flusher, ok := rw.src.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 func Middleware(c *router.Context) {
 	if !strings.Contains(c.Req.Header.Get("Accept-Encoding"), "gzip") {
 		c.Next()
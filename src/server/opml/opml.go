@@ -1,11 +1,17 @@
 package opml
 
 import (
+	"encoding/json"
 	"fmt"
 	"html"
 	"strings"
+
+	"github.com/nkanaev/yarr/src/content/scraper"
 )
 
+// namespace of the outline attributes specific to yarr
+const Namespace = "https://github.com/nkanaev/yarr"
+
 type Folder struct {
 	Title   string
 	Folders []Folder
@@ -16,6 +22,9 @@ type Feed struct {
 	Title   string
 	FeedUrl string
 	SiteUrl string
+
+	// exported as json in the `yarr:scraper` attribute
+	Scraper *scraper.Selectors
 }
 
 func (f Folder) AllFeeds() []Feed {
@@ -51,9 +60,15 @@ func (f Folder) outline(level int) string {
 }
 
 func (f Feed) outline(level int) string {
+	extra := ""
+	if f.Scraper != nil {
+		if data, err := json.Marshal(f.Scraper); err == nil {
+			extra = fmt.Sprintf(` xmlns:yarr="%s" yarr:scraper="%s"`, Namespace, e(string(data)))
+		}
+	}
 	return strings.Repeat(indent, level) + fmt.Sprintf(
-		`<outline type="rss" text="%s" xmlUrl="%s" htmlUrl="%s"/>`+nl,
-		e(f.Title), e(f.FeedUrl), e(f.SiteUrl),
+		`<outline type="rss" text="%s" xmlUrl="%s" htmlUrl="%s"%s/>`+nl,
+		e(f.Title), e(f.FeedUrl), e(f.SiteUrl), extra,
 	)
 }
 
@@ -2,7 +2,10 @@ package opml
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/nkanaev/yarr/src/content/scraper"
 )
 
 func TestOPML(t *testing.T) {
@@ -52,3 +55,29 @@ func TestOPML(t *testing.T) {
 		t.Fatal("invalid opml")
 	}
 }
+
+func TestOPMLScraper(t *testing.T) {
+	folder := Folder{
+		Feeds: []Feed{
+			{
+				Title:   "news",
+				FeedUrl: "https://foo.com/news",
+				SiteUrl: "https://foo.com/news",
+				Scraper: &scraper.Selectors{Item: `div[class="news"] > article`, Title: "h2"},
+			},
+		},
+	}
+	doc := folder.OPML()
+	if !strings.Contains(doc, `yarr:scraper="{&#34;item&#34;:`) {
+		t.Fatalf("missing scraper: %s", doc)
+	}
+	have, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(folder.Feeds, have.Feeds) {
+		t.Logf("want: %#v", folder.Feeds)
+		t.Logf("have: %#v", have.Feeds)
+		t.Fatal("invalid round-trip")
+	}
+}
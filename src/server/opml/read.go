@@ -1,9 +1,11 @@
 package opml
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"io"
 
+	"github.com/nkanaev/yarr/src/content/scraper"
 	"golang.org/x/net/html/charset"
 )
 
@@ -18,6 +20,7 @@ type outline struct {
 	Title2   string    `xml:"title,attr,omitempty"`
 	FeedUrl  string    `xml:"xmlUrl,attr,omitempty"`
 	SiteUrl  string    `xml:"htmlUrl,attr,omitempty"`
+	Scraper  string    `xml:"https://github.com/nkanaev/yarr scraper,attr,omitempty"`
 	Outlines []outline `xml:"outline,omitempty"`
 }
 
@@ -29,6 +32,7 @@ func buildFolder(title string, outlines []outline) Folder {
 				Title:   outline.Title,
 				FeedUrl: outline.FeedUrl,
 				SiteUrl: outline.SiteUrl,
+				Scraper: parseScraper(outline.Scraper),
 			})
 		} else {
 			title := outline.Title
@@ -42,6 +46,18 @@ func buildFolder(title string, outlines []outline) Folder {
 	return folder
 }
 
+// parseScraper decodes the selectors, ignoring the invalid ones.
+func parseScraper(value string) *scraper.Selectors {
+	if value == "" {
+		return nil
+	}
+	var selectors scraper.Selectors
+	if json.Unmarshal([]byte(value), &selectors) != nil || selectors.Validate() != nil {
+		return nil
+	}
+	return &selectors
+}
+
 func Parse(r io.Reader) (Folder, error) {
 	val := new(opml)
 	decoder := xml.NewDecoder(r)
@@ -4,14 +4,18 @@ import (
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nkanaev/yarr/src/assets"
+	"github.com/nkanaev/yarr/src/content/diff"
 	"github.com/nkanaev/yarr/src/content/htmlutil"
 	"github.com/nkanaev/yarr/src/content/readability"
 	"github.com/nkanaev/yarr/src/content/sanitizer"
@@ -34,7 +38,7 @@ func (s *Server) handler() http.Handler {
 			BasePath: s.BasePath,
 			Username: s.Username,
 			Password: s.Password,
-			Public:   []string{"/static", "/fever"},
+			Public:   []string{"/static", "/fever", "/websub"},
 		}
 		r.Use(a.Handler)
 	}
@@ -43,21 +47,37 @@ func (s *Server) handler() http.Handler {
 	r.For("/manifest.json", s.handleManifest)
 	r.For("/static/*path", s.handleStatic)
 	r.For("/api/status", s.handleStatus)
+	r.For("/api/events", s.handleEvents)
 	r.For("/api/folders", s.handleFolderList)
 	r.For("/api/folders/:id", s.handleFolder)
+	r.For("/api/folders/:id/refresh", s.handleFolderRefresh)
 	r.For("/api/feeds", s.handleFeedList)
 	r.For("/api/feeds/refresh", s.handleFeedRefresh)
 	r.For("/api/feeds/errors", s.handleFeedErrors)
 	r.For("/api/feeds/:id/icon", s.handleFeedIcon)
+	r.For("/api/feeds/:id/refresh", s.handleFeedRefreshOne)
+	r.For("/api/feeds/:id/credentials", s.handleFeedCredentials)
+	r.For("/api/feeds/:id/events", s.handleFeedEvents)
+	r.For("/api/feeds/:id/errors", s.handleFeedErrorHistory)
 	r.For("/api/feeds/:id", s.handleFeed)
 	r.For("/api/items", s.handleItemList)
 	r.For("/api/items/:id", s.handleItem)
+	r.For("/api/items/:id/revisions", s.handleItemRevisions)
+	r.For("/api/items/:id/rewrite", s.handleItemRewrite)
+	r.For("/api/labels", s.handleLabelList)
+	r.For("/api/labels/:id", s.handleLabel)
+	r.For("/api/smart_folders", s.handleSmartFolderList)
+	r.For("/api/smart_folders/:id", s.handleSmartFolder)
+	r.For("/api/rules", s.handleRuleList)
+	r.For("/api/rules/dryrun", s.handleRuleDryRun)
+	r.For("/api/rules/:id", s.handleRule)
 	r.For("/api/settings", s.handleSettings)
 	r.For("/opml/import", s.handleOPMLImport)
 	r.For("/opml/export", s.handleOPMLExport)
 	r.For("/page", s.handlePageCrawl)
 	r.For("/logout", s.handleLogout)
 	r.For("/fever/", s.handleFever)
+	r.For("/websub/:id", s.handleWebSub)
 
 	return r
 }
@@ -98,10 +118,53 @@ func (s *Server) handleManifest(c *router.Context) {
 }
 
 func (s *Server) handleStatus(c *router.Context) {
-	c.JSON(http.StatusOK, map[string]interface{}{
-		"running": s.worker.FeedsPending(),
-		"stats":   s.db.FeedStats(),
-	})
+	c.JSON(http.StatusOK, s.worker.Status())
+}
+
+// how often an idle event stream is pinged, so that proxies don't drop it
+const eventsKeepAlive = 30 * time.Second
+
+// handleEvents streams the worker's events (see `worker.Broker`) as Server-Sent Events.
+func (s *Server) handleEvents(c *router.Context) {
+	flusher, ok := c.Out.(http.Flusher)
+	if !ok {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	events := s.worker.Events().Subscribe()
+	defer s.worker.Events().Unsubscribe(events)
+
+	c.Out.Header().Set("Content-Type", "text/event-stream")
+	c.Out.Header().Set("Cache-Control", "no-cache")
+	c.Out.Header().Set("X-Accel-Buffering", "no")
+	c.Out.WriteHeader(http.StatusOK)
+
+	send := func(event worker.Event) {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		fmt.Fprintf(c.Out, "event: %s\ndata: %s\n\n", event.Name, data)
+		flusher.Flush()
+	}
+	send(worker.Event{Name: "status", Data: s.worker.Status()})
+
+	keepalive := time.NewTicker(eventsKeepAlive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case event := <-events:
+			send(event)
+		case <-keepalive.C:
+			fmt.Fprint(c.Out, ": keepalive\n\n")
+			flusher.Flush()
+		case <-c.Req.Context().Done():
+			return
+		case <-s.shutdown:
+			return
+		}
+	}
 }
 
 func (s *Server) handleFolderList(c *router.Context) {
@@ -119,7 +182,11 @@ func (s *Server) handleFolderList(c *router.Context) {
 			c.JSON(http.StatusBadRequest, map[string]string{"error": "Folder title missing."})
 			return
 		}
-		folder := s.db.CreateFolder(body.Title)
+		folder := s.db.CreateFolder(body.Title, body.ParentID)
+		if folder == nil {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to create folder."})
+			return
+		}
 		c.JSON(http.StatusCreated, folder)
 	} else {
 		c.Out.WriteHeader(http.StatusMethodNotAllowed)
@@ -133,21 +200,47 @@ func (s *Server) handleFolder(c *router.Context) {
 		return
 	}
 	if c.Req.Method == "PUT" {
-		var body FolderUpdateForm
+		body := make(map[string]interface{})
 		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
 			log.Print(err)
 			c.Out.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if body.Title != nil {
-			s.db.RenameFolder(id, *body.Title)
+		if title, ok := body["title"]; ok {
+			if reflect.TypeOf(title).Kind() == reflect.String {
+				s.db.RenameFolder(id, title.(string))
+			}
+		}
+		if isExpanded, ok := body["is_expanded"]; ok {
+			if reflect.TypeOf(isExpanded).Kind() == reflect.Bool {
+				s.db.ToggleFolderExpanded(id, isExpanded.(bool))
+			}
+		}
+		if p_id, ok := body["parent_id"]; ok {
+			moved := false
+			if p_id == nil {
+				moved = s.db.UpdateFolderParent(id, nil)
+			} else if reflect.TypeOf(p_id).Kind() == reflect.Float64 {
+				parentId := int64(p_id.(float64))
+				moved = s.db.UpdateFolderParent(id, &parentId)
+			}
+			if !moved {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": "Cannot move folder there."})
+				return
+			}
 		}
-		if body.IsExpanded != nil {
-			s.db.ToggleFolderExpanded(id, *body.IsExpanded)
+		if retention, ok := body["retention"]; ok {
+			policy, err := parseRetentionPolicy(retention)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			s.db.UpdateFolderRetention(id, policy)
 		}
 		c.Out.WriteHeader(http.StatusOK)
 	} else if c.Req.Method == "DELETE" {
 		s.db.DeleteFolder(id)
+		s.worker.PublishStatus()
 		c.Out.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -161,17 +254,151 @@ func (s *Server) handleFeedRefresh(c *router.Context) {
 	}
 }
 
+func (s *Server) handleFeedRefreshOne(c *router.Context) {
+	if c.Req.Method != "POST" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	feed := s.db.GetFeed(id)
+	if feed == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	results, err := s.worker.RefreshFeedsNow([]storage.Feed{*feed})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, results[0])
+}
+
+func (s *Server) handleFeedEvents(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.db.GetFeed(id) == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, s.db.ListFeedEvents(id))
+}
+
+// handleFeedErrorHistory lists the feed's latest errors, the latest first.
+func (s *Server) handleFeedErrorHistory(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.db.GetFeed(id) == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, s.db.ListFeedErrors(id))
+}
+
+// handleFeedCredentials manages the feed's credentials.
+// The secrets are write-only: reading only tells what is set.
+func (s *Server) handleFeedCredentials(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.db.GetFeed(id) == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if c.Req.Method == "GET" {
+		credentials := s.db.GetFeedCredentials(id)
+		if credentials == nil {
+			credentials = &storage.FeedCredentials{}
+		}
+		names := func(values map[string]string) []string {
+			result := make([]string, 0, len(values))
+			for name := range values {
+				result = append(result, name)
+			}
+			sort.Strings(result)
+			return result
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"username": credentials.Username,
+			"password": credentials.Password != "",
+			"token":    credentials.Token != "",
+			"headers":  names(credentials.Headers),
+			"cookies":  names(credentials.Cookies),
+		})
+	} else if c.Req.Method == "PUT" {
+		var credentials storage.FeedCredentials
+		if err := json.NewDecoder(c.Req.Body).Decode(&credentials); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !s.db.UpdateFeedCredentials(id, credentials) {
+			c.Out.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		c.Out.WriteHeader(http.StatusOK)
+	} else if c.Req.Method == "DELETE" {
+		s.db.UpdateFeedCredentials(id, storage.FeedCredentials{})
+		c.Out.WriteHeader(http.StatusNoContent)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleFolderRefresh(c *router.Context) {
+	if c.Req.Method != "POST" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.db.GetFolder(id) == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	feeds := make([]storage.Feed, 0)
+	for _, feed := range s.db.ListFolderFeeds(id) {
+		if !feed.Paused {
+			feeds = append(feeds, feed)
+		}
+	}
+	results, err := s.worker.RefreshFeedsNow(feeds)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
 func (s *Server) handleFeedErrors(c *router.Context) {
 	errors := s.db.GetFeedErrors()
 	c.JSON(http.StatusOK, errors)
 }
 
 type feedicon struct {
-	ctype string
-	bytes []byte
-	etag  string
+	ctype  string
+	bytes  []byte
+	etag   string
+	cached time.Time
 }
 
+// how long the icons are kept in memory (they're refreshed now and then)
+const feedIconCacheTTL = time.Hour
+
 func (s *Server) handleFeedIcon(c *router.Context) {
 	id, err := c.VarInt64("id")
 	if err != nil {
@@ -180,9 +407,30 @@ func (s *Server) handleFeedIcon(c *router.Context) {
 	}
 
 	cachekey := "icon:" + strconv.FormatInt(id, 10)
+
+	if c.Req.Method == "POST" {
+		feed := s.db.GetFeed(id)
+		if feed == nil {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.worker.FindFeedFavicon(*feed)
+		s.cache_mutex.Lock()
+		delete(s.cache, cachekey)
+		s.cache_mutex.Unlock()
+		c.JSON(http.StatusOK, map[string]bool{"has_icon": s.db.GetFeed(id).HasIcon})
+		return
+	} else if c.Req.Method != "GET" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
 	s.cache_mutex.Lock()
 	cachedat := s.cache[cachekey]
 	s.cache_mutex.Unlock()
+	if cachedat != nil && time.Since(cachedat.(feedicon).cached) > feedIconCacheTTL {
+		cachedat = nil
+	}
 	if cachedat == nil {
 		feed := s.db.GetFeed(id)
 		if feed == nil || feed.Icon == nil {
@@ -196,9 +444,10 @@ func (s *Server) handleFeedIcon(c *router.Context) {
 		etag := fmt.Sprintf("%x", hash.Sum(nil))[:16]
 
 		cachedat = feedicon{
-			ctype: http.DetectContentType(*feed.Icon),
-			bytes: *(*feed).Icon,
-			etag:  etag,
+			ctype:  worker.IconType(*feed.Icon),
+			bytes:  *(*feed).Icon,
+			etag:   etag,
+			cached: time.Now(),
 		}
 		s.cache_mutex.Lock()
 		s.cache[cachekey] = cachedat
@@ -213,6 +462,8 @@ func (s *Server) handleFeedIcon(c *router.Context) {
 	}
 
 	c.Out.Header().Set("Content-Type", icon.ctype)
+	// svg icons may carry scripts
+	c.Out.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
 	c.Out.Header().Set("Etag", icon.etag)
 	c.Out.Write(icon.bytes)
 }
@@ -229,7 +480,17 @@ func (s *Server) handleFeedList(c *router.Context) {
 			return
 		}
 
-		result, err := worker.DiscoverFeed(form.Url)
+		var result *worker.DiscoverResult
+		var err error
+		if form.Scraper != nil {
+			if err := form.Scraper.Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid scraper: " + err.Error()})
+				return
+			}
+			result, err = worker.ScrapePage(c.Req.Context(), form.Url, *form.Scraper)
+		} else {
+			result, err = worker.DiscoverFeed(c.Req.Context(), form.Url)
+		}
 		switch {
 		case err != nil:
 			log.Printf("Faild to discover feed for %s: %s", form.Url, err)
@@ -244,13 +505,21 @@ func (s *Server) handleFeedList(c *router.Context) {
 				result.FeedLink,
 				form.FolderID,
 			)
-			items := worker.ConvertItems(result.Feed.Items, *feed)
+			if form.Scraper != nil {
+				s.db.UpdateFeedScraper(feed.Id, form.Scraper)
+				feed.Scraper = form.Scraper
+			}
+			items := s.worker.PrepareItems(*feed, worker.ConvertItems(result.Feed.Items, *feed))
 			if len(items) > 0 {
-				s.db.CreateItems(items)
+				s.db.CreateItems(s.db.FeedRetentionPolicies()[feed.Id].LimitItems(items))
 				s.db.SetFeedSize(feed.Id, len(items))
 				s.db.SyncSearch()
 			}
+			s.db.ScheduleFeedRefresh(feed.Id, time.Now().Add(s.db.FeedRefreshInterval(*feed)))
+			worker.SetFeedHub(*feed, result.Feed, s.db)
+			s.worker.Go(s.worker.RenewWebSubs)
 			s.worker.FindFeedFavicon(*feed)
+			s.worker.PublishStatus()
 
 			c.JSON(http.StatusOK, map[string]interface{}{
 				"status": "success",
@@ -293,9 +562,88 @@ func (s *Server) handleFeed(c *router.Context) {
 				s.db.UpdateFeedFolder(id, &folderId)
 			}
 		}
+		if retention, ok := body["retention"]; ok {
+			policy, err := parseRetentionPolicy(retention)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			s.db.UpdateFeedRetention(id, policy)
+		}
+		if interval, ok := body["refresh_interval"]; ok {
+			if interval == nil {
+				s.db.UpdateFeedRefreshInterval(id, nil)
+			} else if reflect.TypeOf(interval).Kind() == reflect.Float64 && interval.(float64) >= 1 {
+				minutes := int64(interval.(float64))
+				s.db.UpdateFeedRefreshInterval(id, &minutes)
+			} else {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": "refresh_interval must be a number of minutes (or null)."})
+				return
+			}
+		}
+		if unreadOnUpdate, ok := body["unread_on_update"]; ok {
+			if reflect.TypeOf(unreadOnUpdate).Kind() == reflect.Bool {
+				s.db.UpdateFeedUnreadOnUpdate(id, unreadOnUpdate.(bool))
+			}
+		}
+		if fullContent, ok := body["full_content"]; ok {
+			if reflect.TypeOf(fullContent).Kind() == reflect.Bool {
+				s.db.UpdateFeedFullContent(id, fullContent.(bool))
+			}
+		}
+		if paused, ok := body["paused"]; ok {
+			if reflect.TypeOf(paused).Kind() == reflect.Bool {
+				reason := "resumed by the user"
+				if paused.(bool) {
+					reason = "paused by the user"
+				}
+				s.db.UpdateFeedPaused(id, paused.(bool), reason)
+			}
+		}
+		if userAgent, ok := body["user_agent"]; ok {
+			if reflect.TypeOf(userAgent).Kind() == reflect.String {
+				s.db.UpdateFeedUserAgent(id, strings.TrimSpace(userAgent.(string)))
+			}
+		}
+		if proxy, ok := body["proxy"]; ok {
+			value, isString := proxy.(string)
+			value = strings.TrimSpace(value)
+			if !isString {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": "proxy must be a string."})
+				return
+			}
+			// the proxy sent back as listed keeps its password
+			if value != "" && value == feed.RedactedProxy() {
+				value = feed.Proxy
+			}
+			if value != "" {
+				if _, err := worker.ParseProxy(value); err != nil {
+					c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid proxy: " + err.Error()})
+					return
+				}
+			}
+			s.db.UpdateFeedProxy(id, value)
+		}
+		if val, ok := body["scraper"]; ok {
+			selectors, err := parseScraper(val)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			s.db.UpdateFeedScraper(id, selectors)
+		}
+		if val, ok := body["rewrite"]; ok {
+			pipeline, err := parseRewrite(val)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			s.db.UpdateFeedRewrite(id, pipeline)
+		}
 		c.Out.WriteHeader(http.StatusOK)
 	} else if c.Req.Method == "DELETE" {
 		s.db.DeleteFeed(id)
+		s.worker.PublishStatus()
 		c.Out.WriteHeader(http.StatusNoContent)
 	} else {
 		c.Out.WriteHeader(http.StatusMethodNotAllowed)
@@ -315,9 +663,9 @@ func (s *Server) handleItem(c *router.Context) {
 			return
 		}
 
-		// runtime fix for relative links
-		if !htmlutil.IsAPossibleLink(item.Link) {
-			if feed := s.db.GetFeed(item.FeedId); feed != nil {
+		if feed := s.db.GetFeed(item.FeedId); feed != nil {
+			// runtime fix for relative links
+			if !htmlutil.IsAPossibleLink(item.Link) {
 				item.Link = htmlutil.AbsoluteUrl(item.Link, feed.Link)
 			}
 		}
@@ -332,8 +680,17 @@ func (s *Server) handleItem(c *router.Context) {
 			c.Out.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if body.Status != nil {
-			s.db.UpdateItemStatus(id, *body.Status)
+		if body.IsRead != nil {
+			s.db.UpdateItemRead(id, *body.IsRead)
+		}
+		if body.IsStarred != nil {
+			s.db.UpdateItemStarred(id, *body.IsStarred)
+		}
+		if body.Labels != nil {
+			s.db.SetItemLabels(id, *body.Labels)
+		}
+		if body.IsRead != nil || body.IsStarred != nil {
+			s.worker.PublishStatus()
 		}
 		c.Out.WriteHeader(http.StatusOK)
 	} else {
@@ -341,31 +698,154 @@ func (s *Server) handleItem(c *router.Context) {
 	}
 }
 
+// handleItemRewrite previews the item's content rewritten with the given steps
+// (or, if there are none, with the feed's own ones). The feed's steps are applied
+// when the items are stored, so that's how the items stored before look with them.
+func (s *Server) handleItemRewrite(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.Req.Method != "POST" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil && err != io.EOF {
+		log.Print(err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	item := s.db.GetItem(id)
+	if item == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	feed := s.db.GetFeed(item.FeedId)
+	if feed == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	pipeline := feed.Rewrite
+	if val, ok := body["rewrite"]; ok {
+		if pipeline, err = parseRewrite(val); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	link := item.Link
+	if !htmlutil.IsAPossibleLink(link) {
+		link = htmlutil.AbsoluteUrl(link, feed.Link)
+	}
+	// the steps apply to the content as it came, not on top of the current ones
+	original := item.Content
+	if item.RawContent != nil {
+		original = *item.RawContent
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"original": sanitizer.Sanitize(link, original),
+		"content":  sanitizer.Sanitize(link, pipeline.Apply(original)),
+	})
+}
+
+// handleItemRevisions lists the item's previous versions, the oldest first,
+// each with the changes that turned it into the following version.
+func (s *Server) handleItemRevisions(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.Req.Method != "GET" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	item := s.db.GetItem(id)
+	if item == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	revisions := s.db.ListItemRevisions(id)
+	result := make([]map[string]interface{}, len(revisions))
+	for i, revision := range revisions {
+		nextTitle, nextContent := item.Title, item.Content
+		if i+1 < len(revisions) {
+			nextTitle, nextContent = revisions[i+1].Title, revisions[i+1].Content
+		}
+		result[i] = map[string]interface{}{
+			"id":      revision.Id,
+			"title":   revision.Title,
+			"content": sanitizer.Sanitize(item.Link, revision.Content),
+			"date":    revision.Date,
+			"diff": map[string]interface{}{
+				"title":   diff.Words(revision.Title, nextTitle),
+				"content": diff.Words(htmlutil.ExtractText(revision.Content), htmlutil.ExtractText(nextContent)),
+			},
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 func (s *Server) handleItemList(c *router.Context) {
 	if c.Req.Method == "GET" {
 		perPage := 20
 		query := c.Req.URL.Query()
 
-		filter := storage.ItemFilter{}
+		var filter storage.ItemFilter
+		if smartID, err := c.QueryInt64("smart_id"); err == nil {
+			smart := s.db.GetSmartFolder(smartID)
+			if smart == nil {
+				c.Out.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if filter, err = smart.ItemFilter(query.Get("search")); err != nil {
+				writeQueryError(c, err)
+				return
+			}
+		} else if filter, err = storage.ParseQuery(query.Get("search")); err != nil {
+			writeQueryError(c, err)
+			return
+		}
 		if folderID, err := c.QueryInt64("folder_id"); err == nil {
 			filter.FolderID = &folderID
 		}
 		if feedID, err := c.QueryInt64("feed_id"); err == nil {
 			filter.FeedID = &feedID
 		}
+		if labelID, err := c.QueryInt64("label_id"); err == nil {
+			filter.LabelID = &labelID
+		}
 		if after, err := c.QueryInt64("after"); err == nil {
 			filter.After = &after
 		}
-		if status := query.Get("status"); len(status) != 0 {
-			statusValue := storage.StatusValues[status]
-			filter.Status = &statusValue
-		}
-		if search := query.Get("search"); len(search) != 0 {
-			filter.Search = &search
+		// `is:` operators in the search query take precedence
+		switch status := query.Get("status"); status {
+		case "unread", "read":
+			if filter.IsRead == nil {
+				isRead := status == "read"
+				filter.IsRead = &isRead
+			}
+		case "starred":
+			if filter.IsStarred == nil {
+				isStarred := true
+				filter.IsStarred = &isStarred
+			}
 		}
+		filter.CollapseDuplicates = query.Get("collapse") == "true"
 		newestFirst := query.Get("oldest_first") != "true"
 
-		items := s.db.ListItems(filter, perPage+1, newestFirst, false)
+		var items []storage.Item
+		if query.Get("sort") == "relevance" && filter.Search != nil {
+			// ranked results can't be paginated by the last item id
+			offset, err := c.QueryInt64("offset")
+			if err != nil || offset < 0 {
+				offset = 0
+			}
+			items = s.db.SearchItems(filter, perPage+1, int(offset))
+		} else {
+			items = s.db.ListItems(filter, perPage+1, newestFirst, false)
+		}
 		hasMore := false
 		if len(items) == perPage+1 {
 			hasMore = true
@@ -385,12 +865,224 @@ func (s *Server) handleItemList(c *router.Context) {
 			filter.FeedID = &feedID
 		}
 		s.db.MarkItemsRead(filter)
+		s.worker.PublishStatus()
+		c.Out.WriteHeader(http.StatusOK)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeQueryError(c *router.Context, err error) {
+	if qerr, ok := err.(*storage.QueryError); ok {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": qerr.Message,
+			"pos":   qerr.Pos,
+			"token": qerr.Token,
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) handleLabelList(c *router.Context) {
+	if c.Req.Method == "GET" {
+		c.JSON(http.StatusOK, s.db.ListLabels())
+	} else if c.Req.Method == "POST" {
+		var body LabelCreateForm
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(body.Title) == 0 {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Label title missing."})
+			return
+		}
+		label := s.db.CreateLabel(body.Title)
+		c.JSON(http.StatusCreated, label)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleLabel(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.Req.Method == "GET" {
+		label := s.db.GetLabel(id)
+		if label == nil {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		}
+		c.JSON(http.StatusOK, label)
+	} else if c.Req.Method == "PUT" {
+		var body LabelUpdateForm
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if body.Title != nil {
+			s.db.RenameLabel(id, *body.Title)
+		}
 		c.Out.WriteHeader(http.StatusOK)
+	} else if c.Req.Method == "DELETE" {
+		s.db.DeleteLabel(id)
+		c.Out.WriteHeader(http.StatusNoContent)
 	} else {
 		c.Out.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
+func (s *Server) handleSmartFolderList(c *router.Context) {
+	if c.Req.Method == "GET" {
+		c.JSON(http.StatusOK, s.db.ListSmartFolders())
+	} else if c.Req.Method == "POST" {
+		var body SmartFolderForm
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !validSmartFolderForm(c, body) {
+			return
+		}
+		folder := s.db.CreateSmartFolder(body.Title, body.Query, body.FeedID, body.FolderID)
+		c.JSON(http.StatusCreated, folder)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleSmartFolder(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.Req.Method == "GET" {
+		folder := s.db.GetSmartFolder(id)
+		if folder == nil {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		}
+		c.JSON(http.StatusOK, folder)
+	} else if c.Req.Method == "PUT" {
+		var body SmartFolderForm
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !validSmartFolderForm(c, body) {
+			return
+		}
+		s.db.UpdateSmartFolder(storage.SmartFolder{
+			Id:       id,
+			Title:    body.Title,
+			Query:    body.Query,
+			FeedId:   body.FeedID,
+			FolderId: body.FolderID,
+		})
+		c.Out.WriteHeader(http.StatusOK)
+	} else if c.Req.Method == "DELETE" {
+		s.db.DeleteSmartFolder(id)
+		c.Out.WriteHeader(http.StatusNoContent)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func validSmartFolderForm(c *router.Context, body SmartFolderForm) bool {
+	if len(body.Title) == 0 {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Smart folder title missing."})
+		return false
+	}
+	if _, err := storage.ParseQuery(body.Query); err != nil {
+		writeQueryError(c, err)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleRuleList(c *router.Context) {
+	if c.Req.Method == "GET" {
+		c.JSON(http.StatusOK, s.db.ListRules())
+	} else if c.Req.Method == "POST" {
+		rule, ok := decodeRule(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusCreated, s.db.CreateRule(rule))
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleRule(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.Req.Method == "GET" {
+		rule := s.db.GetRule(id)
+		if rule == nil {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		}
+		c.JSON(http.StatusOK, rule)
+	} else if c.Req.Method == "PUT" {
+		rule, ok := decodeRule(c)
+		if !ok {
+			return
+		}
+		rule.Id = id
+		s.db.UpdateRule(rule)
+		c.Out.WriteHeader(http.StatusOK)
+	} else if c.Req.Method == "DELETE" {
+		s.db.DeleteRule(id)
+		c.Out.WriteHeader(http.StatusNoContent)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRuleDryRun lists the stored items the (unsaved) rule would match.
+func (s *Server) handleRuleDryRun(c *router.Context) {
+	if c.Req.Method != "POST" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	rule, ok := decodeRule(c)
+	if !ok {
+		return
+	}
+	items, total := s.db.MatchRule(rule, 50)
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"list":  items,
+		"count": total,
+	})
+}
+
+func decodeRule(c *router.Context) (storage.Rule, bool) {
+	var body RuleForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		log.Print(err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return storage.Rule{}, false
+	}
+	rule := body.rule()
+	if err := rule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return rule, false
+	}
+	return rule, true
+}
+
 func (s *Server) handleSettings(c *router.Context) {
 	if c.Req.Method == "GET" {
 		c.JSON(http.StatusOK, s.db.GetSettings())
@@ -404,6 +1096,7 @@ func (s *Server) handleSettings(c *router.Context) {
 			if _, ok := settings["refresh_rate"]; ok {
 				s.worker.SetRefreshRate(s.db.GetSettingsValueInt64("refresh_rate"))
 			}
+			s.worker.Events().Publish("settings", s.db.GetSettings())
 			c.Out.WriteHeader(http.StatusOK)
 		} else {
 			c.Out.WriteHeader(http.StatusBadRequest)
@@ -424,15 +1117,7 @@ func (s *Server) handleOPMLImport(c *router.Context) {
 			c.Out.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		for _, f := range doc.Feeds {
-			s.db.CreateFeed(f.Title, "", f.SiteUrl, f.FeedUrl, nil)
-		}
-		for _, f := range doc.Folders {
-			folder := s.db.CreateFolder(f.Title)
-			for _, ff := range f.AllFeeds() {
-				s.db.CreateFeed(ff.Title, "", ff.SiteUrl, ff.FeedUrl, &folder.Id)
-			}
-		}
+		s.importOPMLFolder(doc, nil)
 
 		s.worker.FindFavicons()
 		s.worker.RefreshFeeds()
@@ -448,43 +1133,70 @@ func (s *Server) handleOPMLExport(c *router.Context) {
 		c.Out.Header().Set("Content-Type", "application/xml; charset=utf-8")
 		c.Out.Header().Set("Content-Disposition", `attachment; filename="subscriptions.opml"`)
 
-		doc := opml.Folder{}
-
-		feedsByFolderID := make(map[int64][]*storage.Feed)
+		// top-level feeds & folders are grouped under id 0
+		feedsByFolderID := make(map[int64][]storage.Feed)
 		for _, feed := range s.db.ListFeeds() {
-			feed := feed
-			if feed.FolderId == nil {
-				doc.Feeds = append(doc.Feeds, opml.Feed{
-					Title:   feed.Title,
-					FeedUrl: feed.FeedLink,
-					SiteUrl: feed.Link,
-				})
-			} else {
-				id := *feed.FolderId
-				feedsByFolderID[id] = append(feedsByFolderID[id], &feed)
+			var folderId int64
+			if feed.FolderId != nil {
+				folderId = *feed.FolderId
 			}
+			feedsByFolderID[folderId] = append(feedsByFolderID[folderId], feed)
 		}
-
+		foldersByParentID := make(map[int64][]storage.Folder)
 		for _, folder := range s.db.ListFolders() {
-			folderFeeds := feedsByFolderID[folder.Id]
-			if len(folderFeeds) == 0 {
-				continue
+			var parentId int64
+			if folder.ParentId != nil {
+				parentId = *folder.ParentId
 			}
+			foldersByParentID[parentId] = append(foldersByParentID[parentId], folder)
+		}
+
+		var buildFolder func(folder storage.Folder) opml.Folder
+		buildFolder = func(folder storage.Folder) opml.Folder {
 			opmlfolder := opml.Folder{Title: folder.Title}
-			for _, feed := range folderFeeds {
-				opmlfolder.Feeds = append(opmlfolder.Feeds, opml.Feed{
-					Title:   feed.Title,
-					FeedUrl: feed.FeedLink,
-					SiteUrl: feed.Link,
-				})
+			for _, subfolder := range foldersByParentID[folder.Id] {
+				opmlsubfolder := buildFolder(subfolder)
+				if len(opmlsubfolder.AllFeeds()) == 0 {
+					continue
+				}
+				opmlfolder.Folders = append(opmlfolder.Folders, opmlsubfolder)
+			}
+			for _, feed := range feedsByFolderID[folder.Id] {
+				opmlfolder.Feeds = append(opmlfolder.Feeds, opmlFeed(feed))
 			}
-			doc.Folders = append(doc.Folders, opmlfolder)
+			return opmlfolder
 		}
+		doc := buildFolder(storage.Folder{})
 
 		c.Out.Write([]byte(doc.OPML()))
 	}
 }
 
+func (s *Server) importOPMLFolder(folder opml.Folder, folderId *int64) {
+	for _, f := range folder.Feeds {
+		feed := s.db.CreateFeed(f.Title, "", f.SiteUrl, f.FeedUrl, folderId)
+		if feed != nil && f.Scraper != nil {
+			s.db.UpdateFeedScraper(feed.Id, f.Scraper)
+		}
+	}
+	for _, f := range folder.Folders {
+		subfolder := s.db.CreateFolder(f.Title, folderId)
+		if subfolder == nil {
+			continue
+		}
+		s.importOPMLFolder(f, &subfolder.Id)
+	}
+}
+
+func opmlFeed(feed storage.Feed) opml.Feed {
+	return opml.Feed{
+		Title:   feed.Title,
+		FeedUrl: feed.FeedLink,
+		SiteUrl: feed.Link,
+		Scraper: feed.Scraper,
+	}
+}
+
 func (s *Server) handlePageCrawl(c *router.Context) {
 	url := c.Req.URL.Query().Get("url")
 
@@ -498,7 +1210,7 @@ func (s *Server) handlePageCrawl(c *router.Context) {
 		return
 	}
 
-	body, err := worker.GetBody(url)
+	body, err := worker.GetBody(c.Req.Context(), url)
 	if err != nil {
 		log.Print(err)
 		c.Out.WriteHeader(http.StatusBadRequest)
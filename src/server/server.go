@@ -1,9 +1,11 @@
 package server
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/nkanaev/yarr/src/storage"
 	"github.com/nkanaev/yarr/src/worker"
@@ -15,6 +17,8 @@ type Server struct {
 	worker      *worker.Worker
 	cache       map[string]interface{}
 	cache_mutex *sync.Mutex
+	// closed on shutdown, ending the long-lived requests
+	shutdown chan struct{}
 
 	BasePath string
 
@@ -33,6 +37,7 @@ func NewServer(db *storage.Storage, addr string) *Server {
 		worker:      worker.NewWorker(db),
 		cache:       make(map[string]interface{}),
 		cache_mutex: &sync.Mutex{},
+		shutdown:    make(chan struct{}),
 	}
 }
 
@@ -44,24 +49,47 @@ func (h *Server) GetAddr() string {
 	return proto + "://" + h.Addr + h.BasePath
 }
 
-func (s *Server) Start() {
+// how long the requests in progress are waited for on shutdown
+const shutdownTimeout = time.Second * 10
+
+// Start serves the requests & runs the background work until the context is done.
+// Then it stops accepting requests, waits for the ones in progress (for a while)
+// & stops the background work.
+func (s *Server) Start(ctx context.Context) {
 	refreshRate := s.db.GetSettingsValueInt64("refresh_rate")
-	s.worker.FindFavicons()
+	s.worker.StartFaviconRefresh()
 	s.worker.StartFeedCleaner()
+	s.worker.StartWebSubRenewal()
 	s.worker.SetRefreshRate(refreshRate)
 	if refreshRate > 0 {
-		s.worker.RefreshFeeds()
+		s.worker.RefreshDueFeeds()
 	}
 
 	httpserver := &http.Server{Addr: s.Addr, Handler: s.handler()}
+	httpserver.RegisterOnShutdown(func() { close(s.shutdown) })
 
-	var err error
-	if s.CertFile != "" && s.KeyFile != "" {
-		err = httpserver.ListenAndServeTLS(s.CertFile, s.KeyFile)
-	} else {
-		err = httpserver.ListenAndServe()
-	}
-	if err != http.ErrServerClosed {
-		log.Fatal(err)
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.CertFile != "" && s.KeyFile != "" {
+			serveErr <- httpserver.ListenAndServeTLS(s.CertFile, s.KeyFile)
+		} else {
+			serveErr <- httpserver.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	case <-ctx.Done():
+		log.Print("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpserver.Shutdown(shutdownCtx); err != nil {
+			log.Print("failed to wait for the requests in progress: ", err)
+			httpserver.Close()
+		}
 	}
+	s.worker.Stop()
 }
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nkanaev/yarr/src/server/router"
+	"github.com/nkanaev/yarr/src/storage"
+	"github.com/nkanaev/yarr/src/worker"
+)
+
+const (
+	// maximum size of the content pushed by the hub
+	webSubMaxBody = 10 << 20
+	// how long after the (re)subscription request the hub may verify it
+	webSubVerifyWindow = time.Hour
+	// the longest lease accepted from the hub, so that the feed is polled again eventually
+	webSubMaxLease = time.Hour * 24 * 30
+)
+
+// handleWebSub is the callback of the feed's WebSub subscription.
+// The hub verifies the subscription with GET & delivers the updates with POST.
+func (s *Server) handleWebSub(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	websub := s.db.GetWebSub(id)
+
+	switch c.Req.Method {
+	case "GET":
+		s.webSubVerify(c, id, websub)
+	case "POST":
+		s.webSubDeliver(c, id, websub)
+	default:
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) webSubVerify(c *router.Context, feedId int64, websub *storage.WebSub) {
+	query := c.Req.URL.Query()
+	mode := query.Get("hub.mode")
+	topic := query.Get("hub.topic")
+	subscribed := websub != nil && websub.Topic == topic
+
+	switch mode {
+	case "subscribe":
+		if !subscribed {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		}
+		lease, err := strconv.ParseInt(query.Get("hub.lease_seconds"), 10, 64)
+		if err != nil || lease <= 0 {
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		duration := webSubMaxLease
+		if lease < int64(webSubMaxLease/time.Second) {
+			duration = time.Second * time.Duration(lease)
+		}
+		// only the requests sent lately are confirmed
+		now := time.Now()
+		if !s.db.ConfirmWebSub(feedId, now.Add(-webSubVerifyWindow), now.Add(duration)) {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		}
+	case "unsubscribe":
+		// confirm only the subscriptions no longer wanted
+		if subscribed {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		}
+	case "denied":
+		// the subscription is requested again later (the denial may be temporary, or forged)
+		if subscribed {
+			log.Printf("WebSub hub %s denied subscription to %s: %s", websub.Hub, topic, query.Get("hub.reason"))
+			s.db.UpdateWebSubState(feedId, storage.WebSubDenied, nil)
+		}
+		c.Out.WriteHeader(http.StatusOK)
+		return
+	default:
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.Out.Header().Set("Content-Type", "text/plain")
+	c.Out.WriteHeader(http.StatusOK)
+	c.Out.Write([]byte(query.Get("hub.challenge")))
+}
+
+func (s *Server) webSubDeliver(c *router.Context, feedId int64, websub *storage.WebSub) {
+	feed := s.db.GetFeed(feedId)
+	if websub == nil || feed == nil {
+		// tells the hub to stop delivering
+		c.Out.WriteHeader(http.StatusGone)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Req.Body, webSubMaxBody))
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// the content with invalid signature is acknowledged, yet ignored
+	if !worker.VerifySignature(websub.Secret, c.Req.Header.Get("X-Hub-Signature"), body) {
+		log.Printf("WebSub delivery for %s with invalid signature", feed.FeedLink)
+		c.Out.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err := s.worker.Ingest(*feed, bytes.NewReader(body), c.Req.Header.Get("Content-Type")); err != nil {
+		log.Printf("Failed to ingest WebSub delivery for %s: %s", feed.FeedLink, err)
+	}
+	c.Out.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+)
+
+// FeedCredentials are what it takes to fetch a private feed.
+// They're stored apart from the feed, so that they never leak
+// into the feed list or the OPML export.
+type FeedCredentials struct {
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	Token    string            `json:"token"`
+	Headers  map[string]string `json:"headers"`
+	Cookies  map[string]string `json:"cookies"`
+}
+
+func (c FeedCredentials) IsEmpty() bool {
+	return c.Username == "" && c.Password == "" && c.Token == "" &&
+		len(c.Headers) == 0 && len(c.Cookies) == 0
+}
+
+// GetFeedCredentials returns the feed's credentials, or nil if it has none.
+func (s *Storage) GetFeedCredentials(feedId int64) *FeedCredentials {
+	var c FeedCredentials
+	var headers, cookies string
+	err := s.db.QueryRow(`
+		select username, password, token, headers, cookies
+		from feed_credentials where feed_id = ?`,
+		feedId,
+	).Scan(&c.Username, &c.Password, &c.Token, &headers, &cookies)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	if err = json.Unmarshal([]byte(headers), &c.Headers); err != nil {
+		log.Print(err)
+	}
+	if err = json.Unmarshal([]byte(cookies), &c.Cookies); err != nil {
+		log.Print(err)
+	}
+	return &c
+}
+
+// UpdateFeedCredentials replaces the feed's credentials (removes them, if empty).
+func (s *Storage) UpdateFeedCredentials(feedId int64, c FeedCredentials) bool {
+	if c.IsEmpty() {
+		_, err := s.db.Exec(`delete from feed_credentials where feed_id = ?`, feedId)
+		if err != nil {
+			log.Print(err)
+		}
+		return err == nil
+	}
+	headers, err := json.Marshal(c.Headers)
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	cookies, err := json.Marshal(c.Cookies)
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	_, err = s.db.Exec(`
+		insert into feed_credentials (feed_id, username, password, token, headers, cookies)
+		values (?, ?, ?, ?, ?, ?)
+		on conflict (feed_id) do update set
+			username = excluded.username,
+			password = excluded.password,
+			token = excluded.token,
+			headers = excluded.headers,
+			cookies = excluded.cookies`,
+		feedId, c.Username, c.Password, c.Token, string(headers), string(cookies),
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
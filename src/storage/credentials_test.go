@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFeedCredentials(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+	if db.GetFeedCredentials(feed.Id) != nil {
+		t.Fatal("expected no credentials")
+	}
+
+	want := FeedCredentials{
+		Username: "john",
+		Password: "secret",
+		Headers:  map[string]string{"X-Api-Key": "key"},
+		Cookies:  map[string]string{"session": "abc"},
+	}
+	if !db.UpdateFeedCredentials(feed.Id, want) {
+		t.Fatal("failed to store credentials")
+	}
+	have := db.GetFeedCredentials(feed.Id)
+	if have == nil || !reflect.DeepEqual(*have, want) {
+		t.Fatalf("invalid credentials\nwant: %#v\nhave: %#v", want, have)
+	}
+
+	want = FeedCredentials{Token: "token"}
+	db.UpdateFeedCredentials(feed.Id, want)
+	if have = db.GetFeedCredentials(feed.Id); have == nil || have.Token != "token" || have.Username != "" {
+		t.Fatalf("expected the credentials to be replaced, have: %#v", have)
+	}
+
+	db.UpdateFeedCredentials(feed.Id, FeedCredentials{})
+	if have = db.GetFeedCredentials(feed.Id); have != nil {
+		t.Fatalf("expected the credentials to be removed, have: %#v", have)
+	}
+}
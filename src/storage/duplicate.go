@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+)
+
+// short (or missing) descriptions are too common to tell the items apart
+const minHashedTextLength = 100
+
+// duplicateKeys computes the values the item's duplicates are looked up by:
+// the normalized link & the hash of the content's text.
+func duplicateKeys(item Item) (linkKey, contentHash *string) {
+	// links to the site's front page say nothing about the item
+	if key := htmlutil.NormalizeURL(item.Link); strings.Contains(key, "/") || strings.Contains(key, "?") {
+		linkKey = &key
+	}
+	text := strings.ToLower(htmlutil.ExtractText(item.Content))
+	if len(text) >= minHashedTextLength {
+		hash := fmt.Sprintf("%x", md5.Sum([]byte(text)))
+		contentHash = &hash
+	}
+	return
+}
+
+// findCluster looks up an item from another feed with the same link or content,
+// and returns the id of its cluster (creating one if the item was on its own)
+// along with the cluster's read state.
+func findCluster(tx *sql.Tx, feedId int64, linkKey, contentHash *string) (*int64, bool, error) {
+	if linkKey == nil && contentHash == nil {
+		return nil, false, nil
+	}
+	var id int64
+	var clusterId *int64
+	var isRead bool
+	err := tx.QueryRow(`
+		select id, cluster_id, is_read
+		from items
+		where (link_key = ? or content_hash = ?) and feed_id != ?
+		order by id
+		limit 1`,
+		linkKey, contentHash, feedId,
+	).Scan(&id, &clusterId, &isRead)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if clusterId == nil {
+		if _, err = tx.Exec(`update items set cluster_id = id where id = ?`, id); err != nil {
+			return nil, false, err
+		}
+		clusterId = &id
+	}
+	return clusterId, isRead, nil
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestItemDuplicates(t *testing.T) {
+	db := testDB()
+	blog := db.CreateFeed("blog", "", "", "http://blog.com/feed.xml", nil)
+	planet := db.CreateFeed("planet", "", "", "http://planet.com/feed.xml", nil)
+	mirror := db.CreateFeed("mirror", "", "", "http://mirror.com/feed.xml", nil)
+
+	text := strings.Repeat("the very same story ", 10)
+	db.CreateItems([]Item{
+		{GUID: "blog1", FeedId: blog.Id, Link: "https://blog.com/post/1"},
+		{GUID: "blog2", FeedId: blog.Id, Link: "https://blog.com/post/2", Content: "<p>" + text + "</p>"},
+		{GUID: "blog3", FeedId: blog.Id, Link: "https://blog.com/"},
+	})
+	db.CreateItems([]Item{
+		// same link
+		{GUID: "planet1", FeedId: planet.Id, Link: "http://www.blog.com/post/1/?utm_source=planet"},
+		// same content
+		{GUID: "planet2", FeedId: planet.Id, Link: "https://planet.com/2", Content: "<div>" + text + "</div>"},
+		// front page links are ignored
+		{GUID: "planet3", FeedId: planet.Id, Link: "https://blog.com"},
+	})
+	db.CreateItems([]Item{
+		{GUID: "mirror1", FeedId: mirror.Id, Link: "https://blog.com/post/1"},
+	})
+
+	blog1, planet1, mirror1 := getItem(db, "blog1"), getItem(db, "planet1"), getItem(db, "mirror1")
+	if blog1.ClusterId == nil || *blog1.ClusterId != blog1.Id {
+		t.Fatalf("expected item to start a cluster, have: %#v", blog1.ClusterId)
+	}
+	for _, item := range []*Item{planet1, mirror1} {
+		if item.ClusterId == nil || *item.ClusterId != blog1.Id {
+			t.Fatalf("expected item %s to join the cluster, have: %#v", item.GUID, item.ClusterId)
+		}
+	}
+	if blog3, planet3 := getItem(db, "blog3"), getItem(db, "planet3"); blog3.ClusterId != nil || planet3.ClusterId != nil {
+		t.Fatal("expected front page links to be ignored")
+	}
+
+	have := getItemGuids(db.ListItems(ItemFilter{CollapseDuplicates: true}, 10, false, false))
+	want := []string{"blog1", "blog2", "blog3", "planet3"}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("invalid collapsed list\nwant: %#v\nhave: %#v", want, have)
+	}
+	items := db.ListItems(ItemFilter{CollapseDuplicates: true}, 2, false, false)
+	if items[0].Duplicates != 2 || items[1].Duplicates != 1 {
+		t.Fatalf("invalid duplicate counts: %d, %d", items[0].Duplicates, items[1].Duplicates)
+	}
+	if items = db.ListItems(ItemFilter{FeedID: &planet.Id}, 10, false, false); items[2].Duplicates != 0 {
+		t.Fatalf("expected no duplicates, have: %d", items[2].Duplicates)
+	}
+	// the representative is picked among the items within the feed/folder
+	have = getItemGuids(db.ListItems(ItemFilter{FeedID: &planet.Id, CollapseDuplicates: true}, 10, false, false))
+	want = []string{"planet1", "planet2", "planet3"}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("invalid collapsed feed list\nwant: %#v\nhave: %#v", want, have)
+	}
+
+	// siblings share the read state
+	db.UpdateItemRead(planet1.Id, true)
+	if !getItem(db, "blog1").IsRead || !getItem(db, "mirror1").IsRead || getItem(db, "blog2").IsRead {
+		t.Fatal("expected siblings (only) to be marked read")
+	}
+	db.MarkItemsRead(MarkFilter{FeedID: &blog.Id})
+	if !getItem(db, "planet2").IsRead || getItem(db, "planet3").IsRead {
+		t.Fatal("expected siblings from other feeds (only) to be marked read")
+	}
+
+	// new copies of a read story arrive read
+	db.CreateItems([]Item{{GUID: "mirror2", FeedId: mirror.Id, Content: text}})
+	if mirror2 := getItem(db, "mirror2"); !mirror2.IsRead {
+		t.Fatal("expected the new copy to be read")
+	}
+}
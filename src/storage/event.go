@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// kinds of the feed events
+const (
+	FeedMoved   = "moved"
+	FeedMerged  = "merged"
+	FeedPaused  = "paused"
+	FeedResumed = "resumed"
+)
+
+// FeedEvent is an entry of the feed's log of notable changes
+// (such as the feed moving to another url).
+type FeedEvent struct {
+	Id      int64     `json:"id"`
+	FeedId  int64     `json:"feed_id"`
+	Date    time.Time `json:"date"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+}
+
+func (s *Storage) AddFeedEvent(feedId int64, kind, message string) bool {
+	return addFeedEvent(s.db, feedId, kind, message) == nil
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func addFeedEvent(db execer, feedId int64, kind, message string) error {
+	_, err := db.Exec(`
+		insert into feed_events (feed_id, date, kind, message)
+		values (?, ?, ?, ?)`,
+		feedId, time.Now().UTC(), kind, message,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err
+}
+
+// ListFeedEvents returns the feed's events, the latest first.
+func (s *Storage) ListFeedEvents(feedId int64) []FeedEvent {
+	result := make([]FeedEvent, 0)
+	rows, err := s.db.Query(`
+		select id, feed_id, date, kind, message
+		from feed_events
+		where feed_id = ?
+		order by date desc, id desc
+	`, feedId)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var e FeedEvent
+		if err = rows.Scan(&e.Id, &e.FeedId, &e.Date, &e.Kind, &e.Message); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, e)
+	}
+	return result
+}
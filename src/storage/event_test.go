@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateFeedLink(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://old.com/feed.xml", nil)
+
+	if id, ok := db.UpdateFeedLink(feed.Id, "http://new.com/feed.xml"); !ok || id != feed.Id {
+		t.Fatalf("failed to update feed link: %d %v", id, ok)
+	}
+	if have := db.GetFeed(feed.Id).FeedLink; have != "http://new.com/feed.xml" {
+		t.Fatalf("invalid feed link: %s", have)
+	}
+	events := db.ListFeedEvents(feed.Id)
+	if len(events) != 1 || events[0].Kind != FeedMoved {
+		t.Fatalf("invalid events: %#v", events)
+	}
+}
+
+func TestUpdateFeedLinkMerge(t *testing.T) {
+	db := testDB()
+	oldFeed := db.CreateFeed("old", "", "", "http://old.com/feed.xml", nil)
+	newFeed := db.CreateFeed("new", "", "", "http://new.com/feed.xml", nil)
+	db.CreateItems([]Item{
+		{GUID: "item1", FeedId: oldFeed.Id, Title: "old item1"},
+		{GUID: "item2", FeedId: oldFeed.Id, Title: "item2"},
+		{GUID: "item1", FeedId: newFeed.Id, Title: "new item1"},
+	})
+
+	id, ok := db.UpdateFeedLink(oldFeed.Id, "http://new.com/feed.xml")
+	if !ok || id != newFeed.Id {
+		t.Fatalf("expected the feeds to be merged: %d %v", id, ok)
+	}
+	if db.GetFeed(oldFeed.Id) != nil {
+		t.Fatal("expected the old feed to be deleted")
+	}
+	items := db.ListItems(ItemFilter{FeedID: &newFeed.Id}, 10, false, false)
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, have: %#v", items)
+	}
+	if item := getItem(db, "item1"); item.Title != "new item1" {
+		t.Fatalf("expected the existing item to be kept, have: %#v", item)
+	}
+	events := db.ListFeedEvents(newFeed.Id)
+	if len(events) != 1 || events[0].Kind != FeedMerged {
+		t.Fatalf("invalid events: %#v", events)
+	}
+}
+
+func TestUpdateFeedPaused(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+
+	db.UpdateFeedPaused(feed.Id, true, "gone")
+	db.UpdateFeedPaused(feed.Id, true, "gone again")
+	if !db.GetFeed(feed.Id).Paused {
+		t.Fatal("expected the feed to be paused")
+	}
+	if due := db.ListFeedsDue(time.Now()); len(due) != 0 {
+		t.Fatalf("paused feeds aren't due, have: %#v", due)
+	}
+
+	db.UpdateFeedPaused(feed.Id, false, "")
+	if due := db.ListFeedsDue(time.Now()); len(due) != 1 {
+		t.Fatalf("expected the resumed feed to be due, have: %#v", due)
+	}
+	events := db.ListFeedEvents(feed.Id)
+	if len(events) != 2 || events[0].Kind != FeedResumed || events[1].Kind != FeedPaused || events[1].Message != "gone" {
+		t.Fatalf("invalid events: %#v", events)
+	}
+}
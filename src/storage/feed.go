@@ -2,7 +2,13 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
 	"log"
+	"net/url"
+	"time"
+
+	"github.com/nkanaev/yarr/src/content/rewrite"
+	"github.com/nkanaev/yarr/src/content/scraper"
 )
 
 type Feed struct {
@@ -14,6 +20,55 @@ type Feed struct {
 	FeedLink    string  `json:"feed_link"`
 	Icon        *[]byte `json:"icon,omitempty"`
 	HasIcon     bool    `json:"has_icon"`
+
+	Retention RetentionPolicy `json:"retention"`
+
+	// mark the feed's items unread again when the publisher edits them
+	UnreadOnUpdate bool `json:"unread_on_update"`
+
+	// refresh interval (in minutes) overriding the adaptive one
+	RefreshInterval *int64     `json:"refresh_interval"`
+	NextFetch       *time.Time `json:"next_fetch"`
+
+	// fetcher settings overriding the global ones (if not empty).
+	// The proxy's password is hidden in the json (see `MarshalJSON`).
+	UserAgent string `json:"user_agent"`
+	Proxy     string `json:"proxy"`
+
+	// paused feeds aren't refreshed automatically (e.g. if they're gone)
+	Paused bool `json:"paused"`
+
+	// number of the refreshes failed in a row (the feed is fetched less often)
+	Failures int `json:"failures"`
+
+	// the items of the feeds with the selectors are scraped off the html page
+	Scraper *scraper.Selectors `json:"scraper"`
+
+	// the new items' content is replaced by the article from their page
+	FullContent bool `json:"full_content"`
+
+	// the steps cleaning up the items' content before it's displayed
+	Rewrite rewrite.Pipeline `json:"rewrite"`
+}
+
+// MarshalJSON hides the password of the proxy url, so that it isn't sent back.
+func (f Feed) MarshalJSON() ([]byte, error) {
+	type feed Feed
+	out := feed(f)
+	out.Proxy = f.RedactedProxy()
+	return json.Marshal(out)
+}
+
+// RedactedProxy returns the feed's proxy url with the password masked.
+func (f Feed) RedactedProxy() string {
+	if f.Proxy == "" {
+		return ""
+	}
+	u, err := url.Parse(f.Proxy)
+	if err != nil {
+		return ""
+	}
+	return u.Redacted()
 }
 
 func (s *Storage) CreateFeed(title, description, link, feedLink string, folderId *int64) *Feed {
@@ -71,25 +126,211 @@ func (s *Storage) UpdateFeedFolder(feedId int64, newFolderId *int64) bool {
 	return err == nil
 }
 
+func (s *Storage) UpdateFeedUnreadOnUpdate(feedId int64, unreadOnUpdate bool) bool {
+	_, err := s.db.Exec(`update feeds set unread_on_update = ? where id = ?`, unreadOnUpdate, feedId)
+	return err == nil
+}
+
+func (s *Storage) UpdateFeedUserAgent(feedId int64, userAgent string) bool {
+	_, err := s.db.Exec(`update feeds set user_agent = ? where id = ?`, userAgent, feedId)
+	return err == nil
+}
+
+func (s *Storage) UpdateFeedProxy(feedId int64, proxy string) bool {
+	_, err := s.db.Exec(`update feeds set proxy = ? where id = ?`, proxy, feedId)
+	return err == nil
+}
+
+func (s *Storage) UpdateFeedFullContent(feedId int64, fullContent bool) bool {
+	_, err := s.db.Exec(`update feeds set full_content = ? where id = ?`, fullContent, feedId)
+	return err == nil
+}
+
+// UpdateFeedScraper sets the selectors to scrape the feed's page with
+// (nil makes it an ordinary feed again).
+func (s *Storage) UpdateFeedScraper(feedId int64, selectors *scraper.Selectors) bool {
+	value := ""
+	if selectors != nil {
+		data, err := json.Marshal(selectors)
+		if err != nil {
+			log.Print(err)
+			return false
+		}
+		value = string(data)
+	}
+	_, err := s.db.Exec(`update feeds set scraper = ? where id = ?`, value, feedId)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+// UpdateFeedRewrite sets the steps the feed's content is rewritten with.
+func (s *Storage) UpdateFeedRewrite(feedId int64, pipeline rewrite.Pipeline) bool {
+	value := ""
+	if len(pipeline) > 0 {
+		data, err := json.Marshal(pipeline)
+		if err != nil {
+			log.Print(err)
+			return false
+		}
+		value = string(data)
+	}
+	_, err := s.db.Exec(`update feeds set rewrite = ? where id = ?`, value, feedId)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func decodeRewrite(value string) rewrite.Pipeline {
+	if value == "" {
+		return nil
+	}
+	var pipeline rewrite.Pipeline
+	if err := json.Unmarshal([]byte(value), &pipeline); err != nil {
+		log.Print(err)
+		return nil
+	}
+	return pipeline
+}
+
+func decodeScraper(value string) *scraper.Selectors {
+	if value == "" {
+		return nil
+	}
+	var selectors scraper.Selectors
+	if err := json.Unmarshal([]byte(value), &selectors); err != nil {
+		log.Print(err)
+		return nil
+	}
+	return &selectors
+}
+
+// UpdateFeedPaused pauses (or resumes) the automatic refresh of the feed
+// & logs the change. A resumed feed becomes due right away.
+func (s *Storage) UpdateFeedPaused(feedId int64, paused bool, reason string) bool {
+	result, err := s.db.Exec(`
+		update feeds set paused = ?, next_fetch = null
+		where id = ? and paused != ?`,
+		paused, feedId, paused,
+	)
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return true
+	}
+	kind := FeedResumed
+	if paused {
+		kind = FeedPaused
+	}
+	return s.AddFeedEvent(feedId, kind, reason)
+}
+
+// UpdateFeedLink points the feed to its new url & logs the change.
+// If another feed already has that url, the feed is merged into it:
+// the items are moved over (unless the other feed has them already)
+// and the feed is deleted. Returns the id of the feed that's left.
+func (s *Storage) UpdateFeedLink(feedId int64, feedLink string) (int64, bool) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Print(err)
+		return feedId, false
+	}
+	resultId, err := updateFeedLink(tx, feedId, feedLink)
+	if err != nil {
+		log.Print(err)
+		if err = tx.Rollback(); err != nil {
+			log.Print(err)
+		}
+		return feedId, false
+	}
+	if err = tx.Commit(); err != nil {
+		log.Print(err)
+		return feedId, false
+	}
+	return resultId, true
+}
+
+func updateFeedLink(tx *sql.Tx, feedId int64, feedLink string) (int64, error) {
+	var title, oldLink string
+	err := tx.QueryRow(`select title, feed_link from feeds where id = ?`, feedId).Scan(&title, &oldLink)
+	if err != nil {
+		return feedId, err
+	}
+	if oldLink == feedLink {
+		return feedId, nil
+	}
+
+	var otherId int64
+	err = tx.QueryRow(`select id from feeds where feed_link = ?`, feedLink).Scan(&otherId)
+	switch {
+	case err == sql.ErrNoRows:
+		if _, err = tx.Exec(`update feeds set feed_link = ? where id = ?`, feedLink, feedId); err != nil {
+			return feedId, err
+		}
+		return feedId, addFeedEvent(tx, feedId, FeedMoved, "moved from "+oldLink+" to "+feedLink)
+	case err != nil:
+		return feedId, err
+	}
+
+	_, err = tx.Exec(`update or ignore items set feed_id = ? where feed_id = ?`, otherId, feedId)
+	if err != nil {
+		return feedId, err
+	}
+	if _, err = tx.Exec(`delete from feeds where id = ?`, feedId); err != nil {
+		return feedId, err
+	}
+	return otherId, addFeedEvent(tx, otherId, FeedMerged, "merged with "+title+" ("+oldLink+"), which moved here")
+}
+
+// UpdateFeedIcon stores the icon found & the time it was looked for.
+// An empty icon (none found) doesn't replace the one found before.
 func (s *Storage) UpdateFeedIcon(feedId int64, icon *[]byte) bool {
-	_, err := s.db.Exec(`update feeds set icon = ? where id = ?`, icon, feedId)
+	_, err := s.db.Exec(`
+		update feeds
+		set icon = case when length(?) = 0 and length(icon) > 0 then icon else ? end,
+		    icon_checked = ?
+		where id = ?`,
+		icon, icon, time.Now().UTC(), feedId,
+	)
+	if err != nil {
+		log.Print(err)
+	}
 	return err == nil
 }
 
 func (s *Storage) ListFeeds() []Feed {
+	return s.listFeeds("1")
+}
+
+// ListFolderFeeds returns the feeds of the folder and its subfolders.
+func (s *Storage) ListFolderFeeds(folderId int64) []Feed {
+	return s.listFeeds("folder_id in ("+folderTreeQuery+")", folderId)
+}
+
+func (s *Storage) listFeeds(predicate string, args ...interface{}) []Feed {
 	result := make([]Feed, 0)
 	rows, err := s.db.Query(`
 		select id, folder_id, title, description, link, feed_link,
-		       ifnull(length(icon), 0) > 0 as has_icon
+		       ifnull(length(icon), 0) > 0 as has_icon,
+		       keep_days, keep_items, max_items,
+		       unread_on_update, refresh_interval, next_fetch,
+		       user_agent, proxy, paused, scraper, full_content, rewrite,
+		       failures
 		from feeds
+		where `+predicate+`
 		order by title collate nocase
-	`)
+	`, args...)
 	if err != nil {
 		log.Print(err)
 		return result
 	}
 	for rows.Next() {
 		var f Feed
+		var selectors, pipeline string
 		err = rows.Scan(
 			&f.Id,
 			&f.FolderId,
@@ -98,23 +339,41 @@ func (s *Storage) ListFeeds() []Feed {
 			&f.Link,
 			&f.FeedLink,
 			&f.HasIcon,
+			&f.Retention.KeepDays,
+			&f.Retention.KeepItems,
+			&f.Retention.MaxItems,
+			&f.UnreadOnUpdate,
+			&f.RefreshInterval,
+			&f.NextFetch,
+			&f.UserAgent,
+			&f.Proxy,
+			&f.Paused,
+			&selectors,
+			&f.FullContent,
+			&pipeline,
+			&f.Failures,
 		)
 		if err != nil {
 			log.Print(err)
 			return result
 		}
+		f.Scraper = decodeScraper(selectors)
+		f.Rewrite = decodeRewrite(pipeline)
 		result = append(result, f)
 	}
 	return result
 }
 
-func (s *Storage) ListFeedsMissingIcons() []Feed {
+// ListFeedsIconsDue returns the feeds whose icons haven't been looked for
+// since the given time (or at all).
+func (s *Storage) ListFeedsIconsDue(checkedBefore time.Time) []Feed {
 	result := make([]Feed, 0)
 	rows, err := s.db.Query(`
-		select id, folder_id, title, description, link, feed_link
+		select id, folder_id, title, description, link, feed_link,
+		       user_agent, proxy
 		from feeds
-		where icon is null
-	`)
+		where icon is null or icon_checked is null or icon_checked < ?
+	`, checkedBefore.UTC())
 	if err != nil {
 		log.Print(err)
 		return result
@@ -128,6 +387,8 @@ func (s *Storage) ListFeedsMissingIcons() []Feed {
 			&f.Description,
 			&f.Link,
 			&f.FeedLink,
+			&f.UserAgent,
+			&f.Proxy,
 		)
 		if err != nil {
 			log.Print(err)
@@ -140,14 +401,23 @@ func (s *Storage) ListFeedsMissingIcons() []Feed {
 
 func (s *Storage) GetFeed(id int64) *Feed {
 	var f Feed
+	var selectors, pipeline string
 	err := s.db.QueryRow(`
 		select
 			id, folder_id, title, link, feed_link,
-			icon, ifnull(icon, '') != '' as has_icon
+			icon, ifnull(icon, '') != '' as has_icon,
+			keep_days, keep_items, max_items,
+			unread_on_update, refresh_interval, next_fetch,
+			user_agent, proxy, paused, scraper, full_content, rewrite,
+			failures
 		from feeds where id = ?
 	`, id).Scan(
 		&f.Id, &f.FolderId, &f.Title, &f.Link, &f.FeedLink,
 		&f.Icon, &f.HasIcon,
+		&f.Retention.KeepDays, &f.Retention.KeepItems, &f.Retention.MaxItems,
+		&f.UnreadOnUpdate, &f.RefreshInterval, &f.NextFetch,
+		&f.UserAgent, &f.Proxy, &f.Paused, &selectors, &f.FullContent,
+		&pipeline, &f.Failures,
 	)
 	if err != nil {
 		if err != sql.ErrNoRows {
@@ -155,25 +425,108 @@ func (s *Storage) GetFeed(id int64) *Feed {
 		}
 		return nil
 	}
+	f.Scraper = decodeScraper(selectors)
+	f.Rewrite = decodeRewrite(pipeline)
 	return &f
 }
 
-func (s *Storage) ResetFeedErrors() {
-	if _, err := s.db.Exec(`delete from feed_errors`); err != nil {
+// number of the latest errors kept in the feed's error history
+const feedErrorHistorySize = 50
+
+// FeedError is an entry of the feed's error history.
+type FeedError struct {
+	Date  time.Time `json:"date"`
+	Error string    `json:"error"`
+}
+
+// ResetFeedError clears the feed's error & its count of failures in a row,
+// once it's fetched successfully. The error history is kept.
+func (s *Storage) ResetFeedError(feedID int64) {
+	if _, err := s.db.Exec(`delete from feed_errors where feed_id = ?`, feedID); err != nil {
+		log.Print(err)
+	}
+	if _, err := s.db.Exec(`update feeds set failures = 0 where id = ? and failures != 0`, feedID); err != nil {
 		log.Print(err)
 	}
 }
 
+// SetFeedError records the feed's failure: sets its latest error,
+// adds it to the history & counts the failures in a row.
 func (s *Storage) SetFeedError(feedID int64, lastError error) {
-	_, err := s.db.Exec(`
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if err = setFeedError(tx, feedID, lastError.Error()); err != nil {
+		log.Print(err)
+		if err = tx.Rollback(); err != nil {
+			log.Print(err)
+		}
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Print(err)
+	}
+}
+
+func setFeedError(tx *sql.Tx, feedID int64, message string) error {
+	_, err := tx.Exec(`
 		insert into feed_errors (feed_id, error)
 		values (?, ?)
 		on conflict (feed_id) do update set error = excluded.error`,
-		feedID, lastError.Error(),
+		feedID, message,
 	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		insert into feed_error_history (feed_id, date, error)
+		values (?, ?, ?)`,
+		feedID, time.Now().UTC(), message,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		delete from feed_error_history
+		where feed_id = ? and id not in (
+			select id from feed_error_history
+			where feed_id = ?
+			order by id desc
+			limit ?
+		)`,
+		feedID, feedID, feedErrorHistorySize,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`update feeds set failures = failures + 1 where id = ?`, feedID)
+	return err
+}
+
+// ListFeedErrors returns the feed's error history, the latest first.
+func (s *Storage) ListFeedErrors(feedID int64) []FeedError {
+	result := make([]FeedError, 0)
+	rows, err := s.db.Query(`
+		select date, error
+		from feed_error_history
+		where feed_id = ?
+		order by id desc
+	`, feedID)
 	if err != nil {
 		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var e FeedError
+		if err = rows.Scan(&e.Date, &e.Error); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, e)
 	}
+	return result
 }
 
 func (s *Storage) GetFeedErrors() map[int64]string {
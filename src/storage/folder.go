@@ -1,41 +1,138 @@
 package storage
 
 import (
+	"database/sql"
+	"fmt"
 	"log"
 )
 
 type Folder struct {
 	Id         int64  `json:"id"`
+	ParentId   *int64 `json:"parent_id"`
 	Title      string `json:"title"`
 	IsExpanded bool   `json:"is_expanded"`
+
+	Retention RetentionPolicy `json:"retention"`
+}
+
+// folderTreeQuery selects ids of the given folder and all of its descendants.
+var folderTreeQuery = folderTree(`select ?`)
+
+// folderTree returns a query selecting ids of the folders
+// selected by the seed query and all of their descendants.
+func folderTree(seed string) string {
+	return `
+	with recursive folder_tree(id) as (
+		` + seed + `
+		union
+		select f.id from folders f join folder_tree t on f.parent_id = t.id
+	)
+	select id from folder_tree`
 }
 
-func (s *Storage) CreateFolder(title string) *Folder {
+func (s *Storage) CreateFolder(title string, parentId *int64) *Folder {
 	expanded := true
 	row := s.db.QueryRow(`
-		insert into folders (title, is_expanded) values (?, ?)
-		on conflict (title) do update set title = ?
-        returning id`,
-		title, expanded,
+		insert into folders (title, parent_id, is_expanded) values (?, ?, ?)
+		on conflict (ifnull(parent_id, 0), title) do update set title = ?
+        returning id, is_expanded`,
+		title, parentId, expanded,
 		// provide title again so that we can extract row id
 		title,
 	)
 	var id int64
-	err := row.Scan(&id)
+	err := row.Scan(&id, &expanded)
 
 	if err != nil {
 		log.Print(err)
 		return nil
 	}
-	return &Folder{Id: id, Title: title, IsExpanded: expanded}
+	return &Folder{Id: id, ParentId: parentId, Title: title, IsExpanded: expanded}
 }
 
+func (s *Storage) GetFolder(folderId int64) *Folder {
+	var f Folder
+	err := s.db.QueryRow(`
+		select id, parent_id, title, is_expanded,
+		       keep_days, keep_items, max_items
+		from folders where id = ?`,
+		folderId,
+	).Scan(
+		&f.Id, &f.ParentId, &f.Title, &f.IsExpanded,
+		&f.Retention.KeepDays, &f.Retention.KeepItems, &f.Retention.MaxItems,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return &f
+}
+
+// DeleteFolder deletes the folder, moving its subfolders (and feeds) to the top level.
+// The subfolders named like a top-level folder get a numbered title, e.g. "News (2)".
 func (s *Storage) DeleteFolder(folderId int64) bool {
-	_, err := s.db.Exec(`delete from folders where id = ?`, folderId)
+	tx, err := s.db.Begin()
 	if err != nil {
 		log.Print(err)
+		return false
 	}
-	return err == nil
+	if err = deleteFolder(tx, folderId); err != nil {
+		log.Print(err)
+		if err = tx.Rollback(); err != nil {
+			log.Print(err)
+		}
+		return false
+	}
+	if err = tx.Commit(); err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
+
+func deleteFolder(tx *sql.Tx, folderId int64) error {
+	rows, err := tx.Query(`select id, title from folders where parent_id = ?`, folderId)
+	if err != nil {
+		return err
+	}
+	children := make([]Folder, 0)
+	for rows.Next() {
+		var f Folder
+		if err = rows.Scan(&f.Id, &f.Title); err != nil {
+			rows.Close()
+			return err
+		}
+		children = append(children, f)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		title := child.Title
+		for n := 2; ; n++ {
+			var taken bool
+			err = tx.QueryRow(
+				`select exists (select 1 from folders where parent_id is null and title = ?)`,
+				title,
+			).Scan(&taken)
+			if err != nil {
+				return err
+			}
+			if !taken {
+				break
+			}
+			title = fmt.Sprintf("%s (%d)", child.Title, n)
+		}
+		_, err = tx.Exec(`update folders set parent_id = null, title = ? where id = ?`, title, child.Id)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`delete from folders where id = ?`, folderId)
+	return err
 }
 
 func (s *Storage) RenameFolder(folderId int64, newTitle string) bool {
@@ -48,10 +145,35 @@ func (s *Storage) ToggleFolderExpanded(folderId int64, isExpanded bool) bool {
 	return err == nil
 }
 
+// UpdateFolderParent moves the folder under a new parent (or to the top level if nil).
+// Moving a folder into itself or one of its descendants is refused.
+func (s *Storage) UpdateFolderParent(folderId int64, newParentId *int64) bool {
+	if newParentId != nil {
+		var cycle bool
+		err := s.db.QueryRow(
+			`select ? in (`+folderTreeQuery+`)`,
+			*newParentId, folderId,
+		).Scan(&cycle)
+		if err != nil {
+			log.Print(err)
+			return false
+		}
+		if cycle {
+			return false
+		}
+	}
+	_, err := s.db.Exec(`update folders set parent_id = ? where id = ?`, newParentId, folderId)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
 func (s *Storage) ListFolders() []Folder {
 	result := make([]Folder, 0, 0)
 	rows, err := s.db.Query(`
-		select id, title, is_expanded
+		select id, parent_id, title, is_expanded,
+		       keep_days, keep_items, max_items
 		from folders
 		order by title collate nocase
 	`)
@@ -61,7 +183,10 @@ func (s *Storage) ListFolders() []Folder {
 	}
 	for rows.Next() {
 		var f Folder
-		err = rows.Scan(&f.Id, &f.Title, &f.IsExpanded)
+		err = rows.Scan(
+			&f.Id, &f.ParentId, &f.Title, &f.IsExpanded,
+			&f.Retention.KeepDays, &f.Retention.KeepItems, &f.Retention.MaxItems,
+		)
 		if err != nil {
 			log.Print(err)
 			return result
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCreateFolderNested(t *testing.T) {
+	db := testDB()
+	parent := db.CreateFolder("news", nil)
+	child1 := db.CreateFolder("tech", &parent.Id)
+	child2 := db.CreateFolder("tech", &parent.Id)
+	if child1 == nil || child2 == nil || child1.Id != child2.Id {
+		t.Fatalf("expected the same folder.\nwant: %#v\nhave: %#v", child1, child2)
+	}
+	if toplevel := db.CreateFolder("tech", nil); toplevel == nil || toplevel.Id == child1.Id {
+		t.Fatal("expected a separate top-level folder with the same title")
+	}
+	for _, folder := range db.ListFolders() {
+		if folder.Id == child1.Id && (folder.ParentId == nil || *folder.ParentId != parent.Id) {
+			t.Fatalf("invalid parent: %#v", folder)
+		}
+	}
+}
+
+func TestUpdateFolderParent(t *testing.T) {
+	db := testDB()
+	folder1 := db.CreateFolder("folder1", nil)
+	folder2 := db.CreateFolder("folder2", &folder1.Id)
+	folder3 := db.CreateFolder("folder3", &folder2.Id)
+
+	if db.UpdateFolderParent(folder1.Id, &folder1.Id) {
+		t.Error("folder cannot be its own parent")
+	}
+	if db.UpdateFolderParent(folder1.Id, &folder3.Id) {
+		t.Error("folder cannot be moved into its descendant")
+	}
+	if !db.UpdateFolderParent(folder3.Id, &folder1.Id) {
+		t.Error("failed to move folder")
+	}
+	if !db.UpdateFolderParent(folder2.Id, nil) {
+		t.Error("failed to move folder to the top level")
+	}
+
+	parents := make(map[int64]*int64)
+	for _, folder := range db.ListFolders() {
+		parents[folder.Id] = folder.ParentId
+	}
+	if parents[folder2.Id] != nil || parents[folder3.Id] == nil || *parents[folder3.Id] != folder1.Id {
+		t.Fatalf("invalid folder tree: %#v", parents)
+	}
+}
+
+func TestDeleteFolderNested(t *testing.T) {
+	db := testDB()
+	parent := db.CreateFolder("news", nil)
+	child := db.CreateFolder("tech", &parent.Id)
+	other := db.CreateFolder("sports", &parent.Id)
+	db.CreateFolder("tech", nil)
+
+	if !db.DeleteFolder(parent.Id) {
+		t.Fatal("failed to delete the folder")
+	}
+	folders := make(map[int64]Folder)
+	for _, folder := range db.ListFolders() {
+		folders[folder.Id] = folder
+	}
+	if _, ok := folders[parent.Id]; ok || len(folders) != 3 {
+		t.Fatalf("invalid folders: %#v", folders)
+	}
+	if f := folders[child.Id]; f.ParentId != nil || f.Title != "tech (2)" {
+		t.Fatalf("expected the subfolder to be renamed & moved to the top level, have: %#v", f)
+	}
+	if f := folders[other.Id]; f.ParentId != nil || f.Title != "sports" {
+		t.Fatalf("expected the subfolder to be moved to the top level, have: %#v", f)
+	}
+}
+
+func TestListItemsNestedFolder(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+	db.UpdateFolderParent(scope.folder2.Id, &scope.folder1.Id)
+
+	have := getItemGuids(db.ListItems(ItemFilter{FolderID: &scope.folder1.Id}, 10, false, false))
+	want := []string{"item111", "item112", "item113", "item121", "item122", "item211", "item212"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+
+	have = getItemGuids(db.ListItems(ItemFilter{FolderID: &scope.folder2.Id}, 10, false, false))
+	want = []string{"item211", "item212"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+}
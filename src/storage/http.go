@@ -11,11 +11,14 @@ type HTTPState struct {
 
 	LastModified string
 	Etag         string
+
+	// the server asked not to be fetched before that time
+	NextAllowed *time.Time
 }
 
 func (s *Storage) ListHTTPStates() map[int64]HTTPState {
 	result := make(map[int64]HTTPState)
-	rows, err := s.db.Query(`select feed_id, last_refreshed, last_modified, etag from http_states`)
+	rows, err := s.db.Query(`select feed_id, last_refreshed, last_modified, etag, next_allowed from http_states`)
 	if err != nil {
 		log.Print(err)
 		return result
@@ -27,6 +30,7 @@ func (s *Storage) ListHTTPStates() map[int64]HTTPState {
 			&state.LastRefreshed,
 			&state.LastModified,
 			&state.Etag,
+			&state.NextAllowed,
 		)
 		if err != nil {
 			log.Print(err)
@@ -39,7 +43,7 @@ func (s *Storage) ListHTTPStates() map[int64]HTTPState {
 
 func (s *Storage) GetHTTPState(feedID int64) *HTTPState {
 	row := s.db.QueryRow(`
-		select feed_id, last_refreshed, last_modified, etag
+		select feed_id, last_refreshed, last_modified, etag, next_allowed
 		from http_states where feed_id = ?
 	`, feedID)
 
@@ -53,6 +57,7 @@ func (s *Storage) GetHTTPState(feedID int64) *HTTPState {
 		&state.LastRefreshed,
 		&state.LastModified,
 		&state.Etag,
+		&state.NextAllowed,
 	)
 	return &state
 }
@@ -71,3 +76,16 @@ func (s *Storage) SetHTTPState(feedID int64, lastModified, etag string) {
 		log.Print(err)
 	}
 }
+
+// SetHTTPNextAllowed records the earliest time the feed may be fetched again.
+func (s *Storage) SetHTTPNextAllowed(feedID int64, at time.Time) {
+	_, err := s.db.Exec(`
+		insert into http_states (feed_id, last_modified, etag, last_refreshed, next_allowed)
+		values (?, '', '', datetime(), ?)
+		on conflict (feed_id) do update set next_allowed = ?`,
+		feedID, at.UTC(), at.UTC(),
+	)
+	if err != nil {
+		log.Print(err)
+	}
+}
@@ -1,7 +1,7 @@
 package storage
 
 import (
-	"encoding/json"
+	"database/sql"
 	"fmt"
 	"log"
 	"strings"
@@ -10,62 +10,60 @@ import (
 	"github.com/nkanaev/yarr/src/content/htmlutil"
 )
 
-type ItemStatus int
-
-const (
-	UNREAD  ItemStatus = 0
-	READ    ItemStatus = 1
-	STARRED ItemStatus = 2
-)
-
-var StatusRepresentations = map[ItemStatus]string{
-	UNREAD:  "unread",
-	READ:    "read",
-	STARRED: "starred",
-}
-
-var StatusValues = map[string]ItemStatus{
-	"unread":  UNREAD,
-	"read":    READ,
-	"starred": STARRED,
-}
-
-func (s ItemStatus) MarshalJSON() ([]byte, error) {
-	return json.Marshal(StatusRepresentations[s])
-}
-
-func (s *ItemStatus) UnmarshalJSON(b []byte) error {
-	var str string
-	if err := json.Unmarshal(b, &str); err != nil {
-		return err
-	}
-	*s = StatusValues[str]
-	return nil
-}
-
 type Item struct {
-	Id       int64      `json:"id"`
-	GUID     string     `json:"guid"`
-	FeedId   int64      `json:"feed_id"`
-	Title    string     `json:"title"`
-	Link     string     `json:"link"`
-	Content  string     `json:"content,omitempty"`
-	Date     time.Time  `json:"date"`
-	Status   ItemStatus `json:"status"`
-	ImageURL *string    `json:"image"`
-	AudioURL *string    `json:"podcast_url"`
+	Id        int64     `json:"id"`
+	GUID      string    `json:"guid"`
+	FeedId    int64     `json:"feed_id"`
+	Title     string    `json:"title"`
+	Link      string    `json:"link"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content,omitempty"`
+	Date      time.Time `json:"date"`
+	IsRead    bool      `json:"is_read"`
+	IsStarred bool      `json:"is_starred"`
+	ImageURL  *string   `json:"image"`
+	AudioURL  *string   `json:"podcast_url"`
+	Labels    []int64   `json:"labels,omitempty"`
+	Snippet   string    `json:"snippet,omitempty"`
+
+	// the content from the feed, if replaced by the full article
+	Summary *string `json:"summary,omitempty"`
+	// the content before the feed's rewrite steps, if they changed it
+	RawContent *string `json:"-"`
+
+	Categories []string `json:"categories,omitempty"`
+	// the folder the item has been moved to by a rule
+	FolderId *int64 `json:"folder_id,omitempty"`
+
+	// copies of the same story from other feeds share the cluster id
+	ClusterId  *int64 `json:"cluster_id,omitempty"`
+	Duplicates int    `json:"duplicates,omitempty"`
 }
 
 type ItemFilter struct {
-	FolderID *int64
-	FeedID   *int64
-	Status   *ItemStatus
-	Search   *string
-	After    *int64
-	IDs      *[]int64
-	SinceID  *int64
-	MaxID    *int64
-	Before   *time.Time
+	FolderID  *int64
+	FeedID    *int64
+	LabelID   *int64
+	IsRead    *bool
+	IsStarred *bool
+	Search    *string
+	After     *int64
+	IDs       *[]int64
+	SinceID   *int64
+	MaxID     *int64
+	Before    *time.Time
+	Since     *time.Time
+
+	// case-insensitive substring matches
+	FeedName   *string
+	FolderName *string
+	Author     *string
+
+	HasAudio *bool
+	HasImage *bool
+
+	// list a single item per cluster of duplicates
+	CollapseDuplicates bool
 }
 
 type MarkFilter struct {
@@ -75,68 +73,167 @@ type MarkFilter struct {
 	Before *time.Time
 }
 
-func (s *Storage) CreateItems(items []Item) bool {
+// CreateItems stores new items & returns their number. Known items (matched
+// by feed & guid) are updated if the publisher has changed their title or content
+// (the summary, for the full articles) since, the previous version being kept
+// in the item's revision history. The content is compared as it came from the feed,
+// so that changing the feed's rewrite steps doesn't pass for an edit.
+func (s *Storage) CreateItems(items []Item) int {
 	tx, err := s.db.Begin()
 	if err != nil {
 		log.Print(err)
-		return false
+		return 0
 	}
 
 	now := time.Now().UTC()
+	created := 0
+	unreadOnUpdate := make(map[int64]bool)
 
 	for _, item := range items {
-		_, err = tx.Exec(`
-			insert into items (
-				guid, feed_id, title, link, date,
-				content, image, podcast_url,
-				date_arrived, status
+		var id int64
+		var title, content string
+		var searchRowid *int64
+		err = tx.QueryRow(`
+			select id, title, coalesce(summary, raw_content, content, ''), search_rowid
+			from items
+			where feed_id = ? and guid = ?`,
+			item.FeedId, item.GUID,
+		).Scan(&id, &title, &content, &searchRowid)
+		upstream := item.Content
+		if item.RawContent != nil {
+			upstream = *item.RawContent
+		}
+
+		switch {
+		case err == sql.ErrNoRows:
+			original := item
+			if item.Summary != nil {
+				original.Content = *item.Summary
+			}
+			linkKey, contentHash := duplicateKeys(original)
+			var clusterId *int64
+			var isRead bool
+			clusterId, isRead, err = findCluster(tx, item.FeedId, linkKey, contentHash)
+			if err != nil {
+				break
+			}
+			var res sql.Result
+			res, err = tx.Exec(`
+				insert into items (
+					guid, feed_id, title, link, author, date,
+					content, summary, raw_content, image, podcast_url, categories, folder_id,
+					date_arrived, link_key, content_hash, cluster_id, is_read, is_starred
+				)
+				values (?, ?, ?, ?, ?, strftime('%Y-%m-%d %H:%M:%f', ?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				item.GUID, item.FeedId, item.Title, item.Link, item.Author, item.Date,
+				item.Content, item.Summary, item.RawContent, item.ImageURL, item.AudioURL,
+				encodeCategories(item.Categories), item.FolderId,
+				now, linkKey, contentHash, clusterId, isRead || item.IsRead, item.IsStarred,
 			)
-			values (?, ?, ?, ?, strftime('%Y-%m-%d %H:%M:%f', ?), ?, ?, ?, ?, ?)
-			on conflict (feed_id, guid) do nothing`,
-			item.GUID, item.FeedId, item.Title, item.Link, item.Date,
-			item.Content, item.ImageURL, item.AudioURL,
-			now, UNREAD,
-		)
+			if err != nil {
+				break
+			}
+			created++
+			if len(item.Labels) > 0 {
+				if id, err = res.LastInsertId(); err != nil {
+					break
+				}
+				for _, labelId := range item.Labels {
+					if _, err = tx.Exec(`insert into item_labels (item_id, label_id) values (?, ?)`, id, labelId); err != nil {
+						break
+					}
+				}
+			}
+		case err == nil && (title != item.Title || content != upstream):
+			if _, ok := unreadOnUpdate[item.FeedId]; !ok {
+				var flag bool
+				tx.QueryRow(`select unread_on_update from feeds where id = ?`, item.FeedId).Scan(&flag)
+				unreadOnUpdate[item.FeedId] = flag
+			}
+			err = updateItem(tx, id, searchRowid, item, unreadOnUpdate[item.FeedId], now)
+		}
 		if err != nil {
 			log.Print(err)
 			if err = tx.Rollback(); err != nil {
 				log.Print(err)
-				return false
+				return 0
 			}
-			return false
+			return 0
 		}
 	}
 	if err = tx.Commit(); err != nil {
 		log.Print(err)
-		return false
+		return 0
 	}
-	return true
+	return created
+}
+
+func updateItem(tx *sql.Tx, id int64, searchRowid *int64, item Item, markUnread bool, now time.Time) error {
+	_, err := tx.Exec(`
+		insert into item_revisions (item_id, title, content, date)
+		select id, title, ifnull(summary, ifnull(content, '')), ? from items where id = ?`,
+		now, id,
+	)
+	if err != nil {
+		return err
+	}
+	// the item gets re-indexed by the next `SyncSearch`
+	if searchRowid != nil {
+		if _, err = tx.Exec(`delete from search where rowid = ?`, *searchRowid); err != nil {
+			return err
+		}
+	}
+	// the fetched article is kept, the edit goes to the summary it came with
+	upstream := item.Content
+	if item.RawContent != nil {
+		upstream = *item.RawContent
+	}
+	_, err = tx.Exec(`
+		update items
+		set title = ?, search_rowid = null,
+		    content = case when summary is null then ? else content end,
+		    raw_content = case when summary is null then ? else raw_content end,
+		    summary = case when summary is null then null else ? end,
+		    is_read = case when ? then 0 else is_read end
+		where id = ?`,
+		item.Title, item.Content, item.RawContent, upstream, markUnread, id,
+	)
+	return err
 }
 
 func listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interface{}) {
 	cond := make([]string, 0)
 	args := make([]interface{}, 0)
 	if filter.FolderID != nil {
-		cond = append(cond, "i.feed_id in (select id from feeds where folder_id = ?)")
-		args = append(args, *filter.FolderID)
+		cond = append(cond, "(i.folder_id in ("+folderTreeQuery+") or (i.folder_id is null and "+
+			"i.feed_id in (select id from feeds where folder_id in ("+folderTreeQuery+"))))")
+		args = append(args, *filter.FolderID, *filter.FolderID)
 	}
 	if filter.FeedID != nil {
 		cond = append(cond, "i.feed_id = ?")
 		args = append(args, *filter.FeedID)
 	}
-	if filter.Status != nil {
-		cond = append(cond, "i.status = ?")
-		args = append(args, *filter.Status)
+	if filter.LabelID != nil {
+		cond = append(cond, "i.id in (select item_id from item_labels where label_id = ?)")
+		args = append(args, *filter.LabelID)
+	}
+	if filter.IsRead != nil {
+		cond = append(cond, "i.is_read = ?")
+		args = append(args, *filter.IsRead)
+	}
+	if filter.IsStarred != nil {
+		cond = append(cond, "i.is_starred = ?")
+		args = append(args, *filter.IsStarred)
 	}
 	if filter.Search != nil {
-		words := strings.Fields(*filter.Search)
-		terms := make([]string, len(words))
-		for idx, word := range words {
-			terms[idx] = word + "*"
+		if query, negated := searchQuery(*filter.Search); query != "" {
+			if negated {
+				cond = append(cond, "i.search_rowid not in (select rowid from search where search match ?)")
+			} else {
+				cond = append(cond, "i.search_rowid in (select rowid from search where search match ?)")
+			}
+			args = append(args, query)
 		}
-
-		cond = append(cond, "i.search_rowid in (select rowid from search where search match ?)")
-		args = append(args, strings.Join(terms, " "))
 	}
 	if filter.After != nil {
 		compare := ">"
@@ -168,6 +265,51 @@ func listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interfac
 		cond = append(cond, "i.date < ?")
 		args = append(args, filter.Before)
 	}
+	if filter.Since != nil {
+		cond = append(cond, "i.date >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.FeedName != nil {
+		cond = append(cond, "i.feed_id in (select id from feeds where title like ? escape '\\')")
+		args = append(args, likePattern(*filter.FeedName))
+	}
+	if filter.FolderName != nil {
+		folders := folderTree(`select id from folders where title like ? escape '\'`)
+		cond = append(cond, "i.feed_id in (select id from feeds where folder_id in ("+folders+"))")
+		args = append(args, likePattern(*filter.FolderName))
+	}
+	if filter.Author != nil {
+		cond = append(cond, "i.author like ? escape '\\'")
+		args = append(args, likePattern(*filter.Author))
+	}
+	if filter.HasAudio != nil {
+		if *filter.HasAudio {
+			cond = append(cond, "ifnull(i.podcast_url, '') != ''")
+		} else {
+			cond = append(cond, "ifnull(i.podcast_url, '') = ''")
+		}
+	}
+	if filter.CollapseDuplicates {
+		// the oldest copy within the feed/folder being listed represents the cluster
+		scope := ""
+		if filter.FolderID != nil {
+			scope = " and d.feed_id in (select id from feeds where folder_id in (" + folderTreeQuery + "))"
+			args = append(args, *filter.FolderID)
+		}
+		if filter.FeedID != nil {
+			scope += " and d.feed_id = ?"
+			args = append(args, *filter.FeedID)
+		}
+		cond = append(cond, "(i.cluster_id is null or i.id = (select min(d.id) from items d where d.cluster_id = i.cluster_id"+scope+"))")
+	}
+	if filter.HasImage != nil {
+		hasImage := "(ifnull(i.image, '') != '' or i.content like '%<img%')"
+		if *filter.HasImage {
+			cond = append(cond, hasImage)
+		} else {
+			cond = append(cond, "not "+hasImage)
+		}
+	}
 
 	predicate := "1"
 	if len(cond) > 0 {
@@ -183,7 +325,7 @@ func (s *Storage) CountItems(filter ItemFilter) int {
 	var count int
 	query := fmt.Sprintf(`
 		select count(*)
-		from items
+		from items i
 		where %s
 		`, predicate)
 	err := s.db.QueryRow(query, args...).Scan(&count)
@@ -195,12 +337,9 @@ func (s *Storage) CountItems(filter ItemFilter) int {
 }
 
 func (s *Storage) ListItems(filter ItemFilter, limit int, newestFirst bool, withContent bool) []Item {
-	predicate, args := listQueryPredicate(filter, newestFirst)
-	result := make([]Item, 0, 0)
-
-	order := "date desc, id desc"
+	order := "i.date desc, i.id desc"
 	if !newestFirst {
-		order = "date asc, id asc"
+		order = "i.date asc, i.id asc"
 	}
 	if filter.IDs != nil || filter.SinceID != nil {
 		order = "i.id asc"
@@ -208,20 +347,61 @@ func (s *Storage) ListItems(filter ItemFilter, limit int, newestFirst bool, with
 	if filter.MaxID != nil {
 		order = "i.id desc"
 	}
+	return s.listItems(filter, newestFirst, order, limit, 0, withContent)
+}
+
+// SearchItems lists items matching the filter's search query, the most relevant first.
+func (s *Storage) SearchItems(filter ItemFilter, limit, offset int) []Item {
+	if filter.Search == nil {
+		return make([]Item, 0)
+	}
+	if query, negated := searchQuery(*filter.Search); query == "" || negated {
+		// no matches to rank by
+		return s.listItems(filter, true, "i.date desc, i.id desc", limit, offset, false)
+	}
+	// matches in titles weigh more than the ones in the content
+	return s.listItems(filter, true, "bm25(search, 10.0, 1.0), i.id desc", limit, offset, false)
+}
 
-	selectCols := "i.id, i.guid, i.feed_id, i.title, i.link, i.date, i.status, i.image, i.podcast_url"
+func (s *Storage) listItems(filter ItemFilter, newestFirst bool, order string, limit, offset int, withContent bool) []Item {
+	result := make([]Item, 0, 0)
+
+	selectCols := "i.id, i.guid, i.feed_id, i.title, i.link, ifnull(i.author, ''), i.date, i.is_read, i.is_starred, i.image, i.podcast_url, " +
+		"i.cluster_id, (select count(*) from items d where d.cluster_id = i.cluster_id) - (i.cluster_id is not null)"
 	if withContent {
 		selectCols += ", i.content"
 	} else {
 		selectCols += ", '' as content"
 	}
+
+	from := "items i"
+	args := make([]interface{}, 0)
+	match, negated := "", false
+	if filter.Search != nil {
+		match, negated = searchQuery(*filter.Search)
+	}
+	if match != "" && !negated {
+		// join the index directly (instead of filtering by it) to get the snippets & ranking
+		selectCols += ", snippet(search, -1, char(2), char(3), '…', 24)"
+		from = "search join items i on i.search_rowid = search.rowid"
+		args = append(args, match)
+		filter.Search = nil
+	} else {
+		selectCols += ", '' as snippet"
+	}
+	predicate, predicateArgs := listQueryPredicate(filter, newestFirst)
+	if len(args) > 0 {
+		predicate = "search match ? and " + predicate
+	}
+	args = append(args, predicateArgs...)
+
 	query := fmt.Sprintf(`
 		select %s
-		from items i
+		from %s
 		where %s
 		order by %s
-		limit %d
-		`, selectCols, predicate, order, limit)
+		limit %d offset %d
+		`, selectCols, from, predicate, order, limit, offset)
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		log.Print(err)
@@ -231,13 +411,15 @@ func (s *Storage) ListItems(filter ItemFilter, limit int, newestFirst bool, with
 		var x Item
 		err = rows.Scan(
 			&x.Id, &x.GUID, &x.FeedId,
-			&x.Title, &x.Link, &x.Date,
-			&x.Status, &x.ImageURL, &x.AudioURL, &x.Content,
+			&x.Title, &x.Link, &x.Author, &x.Date,
+			&x.IsRead, &x.IsStarred, &x.ImageURL, &x.AudioURL, &x.ClusterId, &x.Duplicates, &x.Content,
+			&x.Snippet,
 		)
 		if err != nil {
 			log.Print(err)
 			return result
 		}
+		x.Snippet = highlightSnippet(x.Snippet)
 		result = append(result, x)
 	}
 	return result
@@ -245,25 +427,71 @@ func (s *Storage) ListItems(filter ItemFilter, limit int, newestFirst bool, with
 
 func (s *Storage) GetItem(id int64) *Item {
 	i := &Item{}
+	var categories string
 	err := s.db.QueryRow(`
 		select
-			i.id, i.guid, i.feed_id, i.title, i.link, i.content,
-			i.date, i.status, i.image, i.podcast_url
+			i.id, i.guid, i.feed_id, i.title, i.link, ifnull(i.author, ''), i.content, i.summary, i.raw_content,
+			i.date, i.is_read, i.is_starred, i.image, i.podcast_url, i.cluster_id,
+			ifnull(i.categories, ''), i.folder_id
 		from items i
 		where i.id = ?
 	`, id).Scan(
-		&i.Id, &i.GUID, &i.FeedId, &i.Title, &i.Link, &i.Content,
-		&i.Date, &i.Status, &i.ImageURL, &i.AudioURL,
+		&i.Id, &i.GUID, &i.FeedId, &i.Title, &i.Link, &i.Author, &i.Content, &i.Summary, &i.RawContent,
+		&i.Date, &i.IsRead, &i.IsStarred, &i.ImageURL, &i.AudioURL, &i.ClusterId,
+		&categories, &i.FolderId,
 	)
 	if err != nil {
 		log.Print(err)
 		return nil
 	}
+	i.Categories = decodeCategories(categories)
+	i.Labels = s.ListItemLabels(i.Id)
 	return i
 }
 
-func (s *Storage) UpdateItemStatus(item_id int64, status ItemStatus) bool {
-	_, err := s.db.Exec(`update items set status = ? where id = ?`, status, item_id)
+// NewItemGUIDs returns which of the given guids the feed has no items with yet.
+func (s *Storage) NewItemGUIDs(feedId int64, guids []string) map[string]bool {
+	result := make(map[string]bool)
+	if len(guids) == 0 {
+		return result
+	}
+	args := []interface{}{feedId}
+	for _, guid := range guids {
+		result[guid] = true
+		args = append(args, guid)
+	}
+	rows, err := s.db.Query(`
+		select guid from items
+		where feed_id = ? and guid in (`+strings.TrimSuffix(strings.Repeat("?,", len(guids)), ",")+`)`,
+		args...,
+	)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var guid string
+		if err = rows.Scan(&guid); err != nil {
+			log.Print(err)
+			return result
+		}
+		delete(result, guid)
+	}
+	return result
+}
+
+// UpdateItemRead sets the read state of the item along with its duplicates.
+func (s *Storage) UpdateItemRead(item_id int64, isRead bool) bool {
+	_, err := s.db.Exec(`
+		update items set is_read = ?
+		where id = ? or cluster_id = (select cluster_id from items where id = ?)`,
+		isRead, item_id, item_id,
+	)
+	return err == nil
+}
+
+func (s *Storage) UpdateItemStarred(item_id int64, isStarred bool) bool {
+	_, err := s.db.Exec(`update items set is_starred = ? where id = ?`, isStarred, item_id)
 	return err == nil
 }
 
@@ -273,11 +501,15 @@ func (s *Storage) MarkItemsRead(filter MarkFilter) bool {
 		FeedID:   filter.FeedID,
 		Before:   filter.Before,
 	}, false)
+	// duplicates from the feeds outside the filter are marked as well
 	query := fmt.Sprintf(`
-		update items as i set status = %d
-		where %s and i.status != %d
-		`, READ, predicate, STARRED)
-	_, err := s.db.Exec(query, args...)
+		update items as i set is_read = 1
+		where i.is_read = 0 and (
+			(%s) or
+			i.cluster_id in (select i.cluster_id from items i where %s and i.cluster_id is not null)
+		)
+		`, predicate, predicate)
+	_, err := s.db.Exec(query, append(args, args...)...)
 	if err != nil {
 		log.Print(err)
 	}
@@ -292,14 +524,11 @@ type FeedStat struct {
 
 func (s *Storage) FeedStats() []FeedStat {
 	result := make([]FeedStat, 0)
-	rows, err := s.db.Query(fmt.Sprintf(`
-		select
-			feed_id,
-			sum(case status when %d then 1 else 0 end),
-			sum(case status when %d then 1 else 0 end)
+	rows, err := s.db.Query(`
+		select feed_id, sum(not is_read), sum(is_starred)
 		from items
 		group by feed_id
-	`, UNREAD, STARRED))
+	`)
 	if err != nil {
 		log.Print(err)
 		return result
@@ -332,7 +561,7 @@ func (s *Storage) SyncSearch() {
 
 	for _, item := range items {
 		result, err := s.db.Exec(`
-			insert into search (title, description, content) values (?, "", ?)`,
+			insert into search (title, content) values (?, ?)`,
 			item.Title, htmlutil.ExtractText(item.Content),
 		)
 		if err != nil {
@@ -362,55 +591,89 @@ var (
 //   - Keep at least the same amount of articles the feed provides (default: 50).
 //     This prevents from deleting items for rarely updated and/or ever-growing
 //     feeds which might eventually reappear as unread.
-//   - Keep entries for a certain period (default: 90 days).
+//   - Keep entries for a certain period (default: 90 days, 0 keeps them forever).
+//   - Never keep more than the maximum amount of articles, if set (default: unlimited).
+//
+// The limits are taken from the feed's retention policy, see `FeedRetentionPolicies`.
 func (s *Storage) DeleteOldItems() {
 	rows, err := s.db.Query(`
-		select
-			i.feed_id,
-			max(coalesce(s.size, 0), ?) as max_items,
-			count(*) as num_items
+		select i.feed_id, coalesce(s.size, 0)
 		from items i
 		left outer join feed_sizes s on s.feed_id = i.feed_id
-		where status != ?
+		where i.is_starred = 0
 		group by i.feed_id
-	`, itemsKeepSize, STARRED)
+	`)
 
 	if err != nil {
 		log.Print(err)
 		return
 	}
 
-	feedLimits := make(map[int64]int64, 0)
+	feedSizes := make(map[int64]int64, 0)
 	for rows.Next() {
-		var feedId, limit int64
-		rows.Scan(&feedId, &limit, nil)
-		feedLimits[feedId] = limit
+		var feedId, size int64
+		rows.Scan(&feedId, &size)
+		feedSizes[feedId] = size
 	}
 
-	for feedId, limit := range feedLimits {
-		result, err := s.db.Exec(`
-			delete from items
-			where id in (
-				select i.id
-				from items i
-				where i.feed_id = ? and status != ?
-				order by date desc
-				limit -1 offset ?
-			) and date_arrived < ?
-			`,
-			feedId,
-			STARRED,
-			limit,
-			time.Now().UTC().Add(-time.Hour*time.Duration(24*itemsKeepDays)),
-		)
-		if err != nil {
-			log.Print(err)
-			return
+	policies := s.FeedRetentionPolicies()
+	now := time.Now().UTC()
+
+	for feedId, size := range feedSizes {
+		policy, ok := policies[feedId]
+		if !ok {
+			continue
 		}
-		numDeleted, err := result.RowsAffected()
-		if err != nil {
-			log.Print(err)
-			return
+
+		var numDeleted int64
+		if days := *policy.KeepDays; days > 0 {
+			limit := size
+			if *policy.KeepItems > limit {
+				limit = *policy.KeepItems
+			}
+			result, err := s.db.Exec(`
+				delete from items
+				where id in (
+					select i.id
+					from items i
+					where i.feed_id = ? and i.is_starred = 0
+					order by date desc
+					limit -1 offset ?
+				) and date_arrived < ?
+				`,
+				feedId,
+				limit,
+				now.Add(-time.Hour*time.Duration(24*days)),
+			)
+			if err != nil {
+				log.Print(err)
+				return
+			}
+			if n, err := result.RowsAffected(); err == nil {
+				numDeleted += n
+			}
+		}
+		if limit := *policy.MaxItems; limit > 0 {
+			result, err := s.db.Exec(`
+				delete from items
+				where id in (
+					select i.id
+					from items i
+					where i.feed_id = ? and i.is_starred = 0
+					order by date desc
+					limit -1 offset ?
+				)
+				`,
+				feedId,
+				limit,
+			)
+			if err != nil {
+				log.Print(err)
+				return
+			}
+			if n, err := result.RowsAffected(); err == nil {
+				numDeleted += n
+			}
 		}
 		if numDeleted > 0 {
 			log.Printf("Deleted %d old items (feed: %d)", numDeleted, feedId)
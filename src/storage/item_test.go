@@ -34,8 +34,8 @@ type testItemScope struct {
 }
 
 func testItemsSetup(db *Storage) testItemScope {
-	folder1 := db.CreateFolder("folder1")
-	folder2 := db.CreateFolder("folder2")
+	folder1 := db.CreateFolder("folder1", nil)
+	folder2 := db.CreateFolder("folder2", nil)
 
 	feed11 := db.CreateFeed("feed11", "", "", "http://test.com/feed11.xml", &folder1.Id)
 	feed12 := db.CreateFeed("feed12", "", "", "http://test.com/feed12.xml", &folder1.Id)
@@ -59,8 +59,8 @@ func testItemsSetup(db *Storage) testItemScope {
 		{GUID: "item012", FeedId: feed01.Id, Title: "title012", Date: now.Add(time.Hour * 24 * 9)},  // read
 		{GUID: "item013", FeedId: feed01.Id, Title: "title013", Date: now.Add(time.Hour * 24 * 10)}, // starred
 	})
-	db.db.Exec(`update items set status = ? where guid in ("item112", "item122", "item211", "item012")`, READ)
-	db.db.Exec(`update items set status = ? where guid in ("item113", "item212", "item013")`, STARRED)
+	db.db.Exec(`update items set is_read = 1 where guid in ("item112", "item122", "item211", "item012")`)
+	db.db.Exec(`update items set is_read = 1, is_starred = 1 where guid in ("item113", "item212", "item013")`)
 
 	return testItemScope{
 		feed11:  feed11,
@@ -76,13 +76,13 @@ func getItem(db *Storage, guid string) *Item {
 	i := &Item{}
 	err := db.db.QueryRow(`
 		select
-			i.id, i.guid, i.feed_id, i.title, i.link, i.content,
-			i.date, i.status, i.image, i.podcast_url
+			i.id, i.guid, i.feed_id, i.title, i.link, i.content, i.summary,
+			i.date, i.is_read, i.is_starred, i.image, i.podcast_url, i.cluster_id
 		from items i
 		where i.guid = ?
 	`, guid).Scan(
-		&i.Id, &i.GUID, &i.FeedId, &i.Title, &i.Link, &i.Content,
-		&i.Date, &i.Status, &i.ImageURL, &i.AudioURL,
+		&i.Id, &i.GUID, &i.FeedId, &i.Title, &i.Link, &i.Content, &i.Summary,
+		&i.Date, &i.IsRead, &i.IsStarred, &i.ImageURL, &i.AudioURL, &i.ClusterId,
 	)
 	if err != nil {
 		log.Fatal(err)
@@ -140,8 +140,8 @@ func TestListItems(t *testing.T) {
 
 	// filter by status
 
-	var starred ItemStatus = STARRED
-	have = getItemGuids(db.ListItems(ItemFilter{Status: &starred}, 10, false, false))
+	starred := true
+	have = getItemGuids(db.ListItems(ItemFilter{IsStarred: &starred}, 10, false, false))
 	want = []string{"item113", "item212", "item013"}
 	if !reflect.DeepEqual(have, want) {
 		t.Logf("want: %#v", want)
@@ -149,8 +149,8 @@ func TestListItems(t *testing.T) {
 		t.Fail()
 	}
 
-	var unread ItemStatus = UNREAD
-	have = getItemGuids(db.ListItems(ItemFilter{Status: &unread}, 10, false, false))
+	read := false
+	have = getItemGuids(db.ListItems(ItemFilter{IsRead: &read}, 10, false, false))
 	want = []string{"item111", "item121", "item011"}
 	if !reflect.DeepEqual(have, want) {
 		t.Logf("want: %#v", want)
@@ -206,8 +206,8 @@ func TestListItemsPaginated(t *testing.T) {
 	}
 
 	// unread, newest first
-	unread := UNREAD
-	have = getItemGuids(db.ListItems(ItemFilter{After: &item012.Id, Status: &unread}, 3, true, false))
+	read := false
+	have = getItemGuids(db.ListItems(ItemFilter{After: &item012.Id, IsRead: &read}, 3, true, false))
 	want = []string{"item011", "item121", "item111"}
 	if !reflect.DeepEqual(have, want) {
 		t.Logf("want: %#v", want)
@@ -216,8 +216,8 @@ func TestListItemsPaginated(t *testing.T) {
 	}
 
 	// starred, oldest first
-	starred := STARRED
-	have = getItemGuids(db.ListItems(ItemFilter{After: &item121.Id, Status: &starred}, 3, false, false))
+	starred := true
+	have = getItemGuids(db.ListItems(ItemFilter{After: &item121.Id, IsStarred: &starred}, 3, false, false))
 	want = []string{"item212", "item013"}
 	if !reflect.DeepEqual(have, want) {
 		t.Logf("want: %#v", want)
@@ -227,17 +227,14 @@ func TestListItemsPaginated(t *testing.T) {
 }
 
 func TestMarkItemsRead(t *testing.T) {
-	// NOTE: starred items must not be marked as read
-	var read ItemStatus = READ
+	unread := false
 
 	db1 := testDB()
 	testItemsSetup(db1)
+	db1.UpdateItemRead(getItem(db1, "item113").Id, false)
 	db1.MarkItemsRead(MarkFilter{})
-	have := getItemGuids(db1.ListItems(ItemFilter{Status: &read}, 10, false, false))
-	want := []string{
-		"item111", "item112", "item121", "item122",
-		"item211", "item011", "item012",
-	}
+	have := getItemGuids(db1.ListItems(ItemFilter{IsRead: &unread}, 10, false, false))
+	want := []string{}
 	if !reflect.DeepEqual(have, want) {
 		t.Logf("want: %#v", want)
 		t.Logf("have: %#v", have)
@@ -247,11 +244,8 @@ func TestMarkItemsRead(t *testing.T) {
 	db2 := testDB()
 	scope2 := testItemsSetup(db2)
 	db2.MarkItemsRead(MarkFilter{FolderID: &scope2.folder1.Id})
-	have = getItemGuids(db2.ListItems(ItemFilter{Status: &read}, 10, false, false))
-	want = []string{
-		"item111", "item112", "item121", "item122",
-		"item211", "item012",
-	}
+	have = getItemGuids(db2.ListItems(ItemFilter{IsRead: &unread}, 10, false, false))
+	want = []string{"item011"}
 	if !reflect.DeepEqual(have, want) {
 		t.Logf("want: %#v", want)
 		t.Logf("have: %#v", have)
@@ -261,11 +255,8 @@ func TestMarkItemsRead(t *testing.T) {
 	db3 := testDB()
 	scope3 := testItemsSetup(db3)
 	db3.MarkItemsRead(MarkFilter{FeedID: &scope3.feed11.Id})
-	have = getItemGuids(db3.ListItems(ItemFilter{Status: &read}, 10, false, false))
-	want = []string{
-		"item111", "item112", "item122",
-		"item211", "item012",
-	}
+	have = getItemGuids(db3.ListItems(ItemFilter{IsRead: &unread}, 10, false, false))
+	want = []string{"item121", "item011"}
 	if !reflect.DeepEqual(have, want) {
 		t.Logf("want: %#v", want)
 		t.Logf("have: %#v", have)
@@ -273,6 +264,39 @@ func TestMarkItemsRead(t *testing.T) {
 	}
 }
 
+func TestItemReadStarredIndependent(t *testing.T) {
+	db := testDB()
+	testItemsSetup(db)
+	item := getItem(db, "item113")
+
+	// starring or unstarring an item keeps its read state
+	db.UpdateItemRead(item.Id, false)
+	db.UpdateItemStarred(item.Id, false)
+	db.UpdateItemStarred(item.Id, true)
+	if item = getItem(db, "item113"); item.IsRead || !item.IsStarred {
+		t.Fatalf("expected starred unread item, have: %#v", item)
+	}
+
+	unread, starred := false, true
+	have := getItemGuids(db.ListItems(ItemFilter{IsRead: &unread, IsStarred: &starred}, 10, false, false))
+	want := []string{"item113"}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("invalid starred unread items\nwant: %#v\nhave: %#v", want, have)
+	}
+
+	for _, stat := range db.FeedStats() {
+		if stat.FeedId == item.FeedId && (stat.UnreadCount != 2 || stat.StarredCount != 1) {
+			t.Fatalf("invalid feed stats: %#v", stat)
+		}
+	}
+
+	// marking the feed as read includes starred items & keeps them starred
+	db.MarkItemsRead(MarkFilter{FeedID: &item.FeedId})
+	if item = getItem(db, "item113"); !item.IsRead || !item.IsStarred {
+		t.Fatalf("expected starred read item, have: %#v", item)
+	}
+}
+
 func TestDeleteOldItems(t *testing.T) {
 	extraItems := 10
 
@@ -328,3 +352,29 @@ func TestDeleteOldItems(t *testing.T) {
 		)
 	}
 }
+
+func TestItemAuthor(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+	db.CreateItems([]Item{
+		{GUID: "item1", FeedId: feed.Id, Title: "title1", Author: "John Doe"},
+		{GUID: "item2", FeedId: feed.Id, Title: "title2"},
+	})
+
+	items := db.ListItems(ItemFilter{FeedID: &feed.Id}, 10, false, false)
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(items))
+	}
+	for _, item := range items {
+		want := ""
+		if item.GUID == "item1" {
+			want = "John Doe"
+		}
+		if item.Author != want {
+			t.Errorf("invalid author for %s\nwant: %#v\nhave: %#v", item.GUID, want, item.Author)
+		}
+		if have := db.GetItem(item.Id).Author; have != want {
+			t.Errorf("invalid author for %s\nwant: %#v\nhave: %#v", item.GUID, want, have)
+		}
+	}
+}
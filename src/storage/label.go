@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"log"
+)
+
+type Label struct {
+	Id    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+func (s *Storage) CreateLabel(title string) *Label {
+	row := s.db.QueryRow(`
+		insert into labels (title) values (?)
+		on conflict (title) do update set title = ?
+		returning id`,
+		title,
+		// provide title again so that we can extract row id
+		title,
+	)
+	var id int64
+	if err := row.Scan(&id); err != nil {
+		log.Print(err)
+		return nil
+	}
+	return &Label{Id: id, Title: title}
+}
+
+func (s *Storage) GetLabel(labelId int64) *Label {
+	var l Label
+	err := s.db.QueryRow(`select id, title from labels where id = ?`, labelId).Scan(&l.Id, &l.Title)
+	if err != nil {
+		return nil
+	}
+	return &l
+}
+
+func (s *Storage) RenameLabel(labelId int64, newTitle string) bool {
+	_, err := s.db.Exec(`update labels set title = ? where id = ?`, newTitle, labelId)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) DeleteLabel(labelId int64) bool {
+	_, err := s.db.Exec(`delete from labels where id = ?`, labelId)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) ListLabels() []Label {
+	result := make([]Label, 0)
+	rows, err := s.db.Query(`
+		select id, title
+		from labels
+		order by title collate nocase
+	`)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var l Label
+		if err = rows.Scan(&l.Id, &l.Title); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, l)
+	}
+	return result
+}
+
+func (s *Storage) AddItemLabel(itemId, labelId int64) bool {
+	_, err := s.db.Exec(`
+		insert into item_labels (item_id, label_id) values (?, ?)
+		on conflict (item_id, label_id) do nothing`,
+		itemId, labelId,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) RemoveItemLabel(itemId, labelId int64) bool {
+	_, err := s.db.Exec(`delete from item_labels where item_id = ? and label_id = ?`, itemId, labelId)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+// SetItemLabels replaces the labels attached to the item with the given ones.
+func (s *Storage) SetItemLabels(itemId int64, labelIds []int64) bool {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	if _, err = tx.Exec(`delete from item_labels where item_id = ?`, itemId); err != nil {
+		log.Print(err)
+		tx.Rollback()
+		return false
+	}
+	for _, labelId := range labelIds {
+		_, err = tx.Exec(`
+			insert into item_labels (item_id, label_id) values (?, ?)
+			on conflict (item_id, label_id) do nothing`,
+			itemId, labelId,
+		)
+		if err != nil {
+			log.Print(err)
+			tx.Rollback()
+			return false
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
+
+func (s *Storage) ListItemLabels(itemId int64) []int64 {
+	result := make([]int64, 0)
+	rows, err := s.db.Query(`
+		select label_id from item_labels where item_id = ? order by label_id
+	`, itemId)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, id)
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	db := testDB()
+	label1 := db.CreateLabel("security")
+	label2 := db.CreateLabel("release-notes")
+	if label1 == nil || label2 == nil {
+		t.Fatal("expected labels")
+	}
+	if same := db.CreateLabel("security"); same == nil || same.Id != label1.Id {
+		t.Fatalf("expected the same label.\nwant: %#v\nhave: %#v", label1, same)
+	}
+
+	db.RenameLabel(label2.Id, "changelog")
+	have := db.ListLabels()
+	want := []Label{{Id: label2.Id, Title: "changelog"}, {Id: label1.Id, Title: "security"}}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("invalid label list\nwant: %#v\nhave: %#v", want, have)
+	}
+}
+
+func TestItemLabels(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+	label1 := db.CreateLabel("to-review")
+	label2 := db.CreateLabel("security")
+
+	item111 := getItem(db, "item111")
+	item212 := getItem(db, "item212")
+
+	db.AddItemLabel(item111.Id, label1.Id)
+	db.AddItemLabel(item212.Id, label1.Id)
+	db.AddItemLabel(item212.Id, label1.Id)
+	db.SetItemLabels(item111.Id, []int64{label1.Id, label2.Id})
+
+	if have := db.GetItem(item111.Id).Labels; !reflect.DeepEqual(have, []int64{label1.Id, label2.Id}) {
+		t.Errorf("invalid item labels: %#v", have)
+	}
+
+	have := getItemGuids(db.ListItems(ItemFilter{LabelID: &label1.Id}, 10, false, false))
+	want := []string{"item111", "item212"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+
+	have = getItemGuids(db.ListItems(ItemFilter{LabelID: &label1.Id, FolderID: &scope.folder2.Id}, 10, false, false))
+	want = []string{"item212"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+
+	db.RemoveItemLabel(item212.Id, label1.Id)
+	db.DeleteLabel(label2.Id)
+	if have := db.GetItem(item111.Id).Labels; !reflect.DeepEqual(have, []int64{label1.Id}) {
+		t.Errorf("invalid item labels after delete: %#v", have)
+	}
+	if have := db.ListItems(ItemFilter{LabelID: &label1.Id}, 10, false, false); len(have) != 1 {
+		t.Errorf("expected a single labelled item, got %d", len(have))
+	}
+}
@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"crypto/md5"
 	"database/sql"
 	"fmt"
 	"log"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
 )
 
 var migrations = []func(*sql.Tx) error{
@@ -16,6 +22,27 @@ var migrations = []func(*sql.Tx) error{
 	m06_fill_missing_dates,
 	m07_add_feed_size,
 	m08_normalize_datetime,
+	m09_labels,
+	m10_nested_folders,
+	m11_retention_policies,
+	m12_search_fts5,
+	m13_smart_folders,
+	m14_read_starred_flags,
+	m15_item_revisions,
+	m16_item_duplicates,
+	m17_feed_schedule,
+	m18_http_next_allowed,
+	m19_feed_credentials,
+	m20_feed_fetch_settings,
+	m21_feed_events,
+	m22_websub_subscriptions,
+	m23_feed_scraper,
+	m24_full_content,
+	m25_rules,
+	m26_feed_rewrite,
+	m27_feed_icon_checked,
+	m28_feed_failures,
+	m29_item_raw_content,
 }
 
 var maxVersion = int64(len(migrations))
@@ -294,3 +321,449 @@ func m08_normalize_datetime(tx *sql.Tx) error {
 	_, err = tx.Exec(`update items set date = strftime('%Y-%m-%d %H:%M:%f', date);`)
 	return err
 }
+
+func m09_labels(tx *sql.Tx) error {
+	sql := `
+		create table if not exists labels (
+		 id             integer primary key autoincrement,
+		 title          text not null
+		);
+
+		create unique index if not exists idx_label_title on labels(title);
+
+		create table if not exists item_labels (
+		 item_id        references items(id) on delete cascade,
+		 label_id       references labels(id) on delete cascade,
+		 primary key (item_id, label_id)
+		);
+
+		create index if not exists idx_item_label_label_id on item_labels(label_id);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m10_nested_folders(tx *sql.Tx) error {
+	sql := `
+		alter table folders add column parent_id references folders(id) on delete set null;
+
+		drop index if exists idx_folder_title;
+		create unique index if not exists idx_folder_parent_title on folders(ifnull(parent_id, 0), title);
+		create index if not exists idx_folder_parent_id on folders(parent_id);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m11_retention_policies(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column keep_days integer;
+		alter table feeds add column keep_items integer;
+		alter table feeds add column max_items integer;
+
+		alter table folders add column keep_days integer;
+		alter table folders add column keep_items integer;
+		alter table folders add column max_items integer;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m12_search_fts5(tx *sql.Tx) error {
+	sql := `
+		drop trigger if exists del_item_search;
+		drop table if exists search;
+
+		create virtual table search using fts5(title, content);
+
+		create trigger if not exists del_item_search after delete on items begin
+		  delete from search where rowid = old.search_rowid;
+		end;
+
+		update items set search_rowid = null;
+	`
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	// rebuild the index
+	rows, err := tx.Query(`select id, ifnull(title, ''), ifnull(content, '') from items`)
+	if err != nil {
+		return err
+	}
+	type searchItem struct {
+		id      int64
+		title   string
+		content string
+	}
+	items := make([]searchItem, 0)
+	for rows.Next() {
+		var item searchItem
+		if err = rows.Scan(&item.id, &item.title, &item.content); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+
+	for _, item := range items {
+		result, err := tx.Exec(
+			`insert into search (title, content) values (?, ?)`,
+			item.title, htmlutil.ExtractText(item.content),
+		)
+		if err != nil {
+			return err
+		}
+		rowId, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`update items set search_rowid = ? where id = ?`, rowId, item.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func m13_smart_folders(tx *sql.Tx) error {
+	sql := `
+		create table if not exists smart_folders (
+		 id             integer primary key autoincrement,
+		 title          text not null,
+		 query          text not null default '',
+		 feed_id        references feeds(id) on delete cascade,
+		 folder_id      references folders(id) on delete cascade
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m14_read_starred_flags(tx *sql.Tx) error {
+	// starred items used to be excluded from the unread ones,
+	// so they're converted into read & starred
+	sql := `
+		alter table items add column is_read integer not null default 0;
+		alter table items add column is_starred integer not null default 0;
+
+		update items set is_read = 1 where status != 0;
+		update items set is_starred = 1 where status = 2;
+
+		drop index if exists idx_item_status;
+		alter table items drop column status;
+
+		create index if not exists idx_item_is_read on items(is_read);
+		create index if not exists idx_item_is_starred on items(is_starred);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m15_item_revisions(tx *sql.Tx) error {
+	sql := `
+		create table if not exists item_revisions (
+		 id             integer primary key autoincrement,
+		 item_id        references items(id) on delete cascade,
+		 title          text not null,
+		 content        text not null,
+		 date           datetime not null
+		);
+
+		create index if not exists idx_item_revision_item_id on item_revisions(item_id);
+
+		alter table feeds add column unread_on_update integer not null default 0;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m16_item_duplicates(tx *sql.Tx) error {
+	sql := `
+		alter table items add column link_key text;
+		alter table items add column content_hash text;
+		alter table items add column cluster_id integer;
+
+		create index if not exists idx_item_link_key on items(link_key);
+		create index if not exists idx_item_content_hash on items(content_hash);
+		create index if not exists idx_item_cluster_id on items(cluster_id);
+	`
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	// fingerprint & cluster the existing items, the oldest first
+	rows, err := tx.Query(`select id, feed_id, ifnull(link, ''), ifnull(content, '') from items order by id`)
+	if err != nil {
+		return err
+	}
+	items := make([]Item, 0)
+	for rows.Next() {
+		var item Item
+		if err = rows.Scan(&item.Id, &item.FeedId, &item.Link, &item.Content); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+
+	for _, item := range items {
+		linkKey, contentHash := m16DuplicateKeys(item)
+		clusterId, err := m16FindCluster(tx, item.FeedId, linkKey, contentHash)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			`update items set link_key = ?, content_hash = ?, cluster_id = ? where id = ?`,
+			linkKey, contentHash, clusterId, item.Id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// m16DuplicateKeys & m16FindCluster are frozen copies of `duplicateKeys` & `findCluster`,
+// so that the migration keeps its outcome whatever happens to the live ones.
+func m16DuplicateKeys(item Item) (linkKey, contentHash *string) {
+	if key := m16NormalizeURL(item.Link); strings.Contains(key, "/") || strings.Contains(key, "?") {
+		linkKey = &key
+	}
+	text := strings.ToLower(htmlutil.ExtractText(item.Content))
+	if len(text) >= 100 {
+		hash := fmt.Sprintf("%x", md5.Sum([]byte(text)))
+		contentHash = &hash
+	}
+	return
+}
+
+func m16NormalizeURL(val string) string {
+	u, err := url.Parse(strings.TrimSpace(val))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") || strings.HasPrefix(key, "mc_") || key == "fbclid" || key == "gclid" {
+			query.Del(key)
+		}
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			params = append(params, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	result := host + strings.TrimRight(u.EscapedPath(), "/")
+	if len(params) > 0 {
+		result += "?" + strings.Join(params, "&")
+	}
+	return result
+}
+
+func m16FindCluster(tx *sql.Tx, feedId int64, linkKey, contentHash *string) (*int64, error) {
+	if linkKey == nil && contentHash == nil {
+		return nil, nil
+	}
+	var id int64
+	var clusterId *int64
+	err := tx.QueryRow(`
+		select id, cluster_id
+		from items
+		where (link_key = ? or content_hash = ?) and feed_id != ?
+		order by id
+		limit 1`,
+		linkKey, contentHash, feedId,
+	).Scan(&id, &clusterId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if clusterId == nil {
+		if _, err = tx.Exec(`update items set cluster_id = id where id = ?`, id); err != nil {
+			return nil, err
+		}
+		clusterId = &id
+	}
+	return clusterId, nil
+}
+
+func m17_feed_schedule(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column refresh_interval integer;
+		alter table feeds add column next_fetch datetime;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m18_http_next_allowed(tx *sql.Tx) error {
+	sql := `
+		alter table http_states add column next_allowed datetime;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m19_feed_credentials(tx *sql.Tx) error {
+	sql := `
+		create table if not exists feed_credentials (
+		 feed_id        references feeds(id) on delete cascade unique,
+		 username       text not null default '',
+		 password       text not null default '',
+		 token          text not null default '',
+		 headers        text not null default '{}',
+		 cookies        text not null default '{}'
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m20_feed_fetch_settings(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column user_agent text not null default '';
+		alter table feeds add column proxy text not null default '';
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m21_feed_events(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column paused integer not null default 0;
+
+		create table if not exists feed_events (
+		 id             integer primary key autoincrement,
+		 feed_id        references feeds(id) on delete cascade,
+		 date           datetime not null,
+		 kind           text not null,
+		 message        text not null default ''
+		);
+
+		create index if not exists idx_feed_events_feed_id on feed_events(feed_id);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m22_websub_subscriptions(tx *sql.Tx) error {
+	sql := `
+		create table if not exists websub_subscriptions (
+		 feed_id        references feeds(id) on delete cascade unique,
+		 hub            text not null,
+		 topic          text not null,
+		 secret         text not null default '',
+		 state          text not null default '',
+		 lease_expires  datetime,
+		 requested_at   datetime
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m23_feed_scraper(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column scraper text not null default '';
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m24_full_content(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column full_content integer not null default 0;
+		alter table items add column summary text;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m25_rules(tx *sql.Tx) error {
+	sql := `
+		create table if not exists rules (
+		 id               integer primary key autoincrement,
+		 title            text not null default '',
+		 feed_id          references feeds(id) on delete cascade,
+		 folder_id        references folders(id) on delete cascade,
+		 field            text not null,
+		 match            text not null,
+		 pattern          text not null,
+		 action           text not null,
+		 label_id         references labels(id) on delete cascade,
+		 target_folder_id references folders(id) on delete cascade,
+		 enabled          integer not null default 1,
+		 hits             integer not null default 0
+		);
+
+		create table if not exists dropped_items (
+		 feed_id        references feeds(id) on delete cascade,
+		 guid           string not null,
+		 primary key (feed_id, guid)
+		);
+
+		alter table items add column categories text;
+		alter table items add column folder_id references folders(id) on delete set null;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m26_feed_rewrite(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column rewrite text not null default '';
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m27_feed_icon_checked(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column icon_checked datetime;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m28_feed_failures(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column failures integer not null default 0;
+
+		create table if not exists feed_error_history (
+		 id             integer primary key autoincrement,
+		 feed_id        references feeds(id) on delete cascade,
+		 date           datetime not null,
+		 error          text not null
+		);
+
+		create index if not exists idx_feed_error_history_feed_id on feed_error_history(feed_id);
+
+		insert into feed_error_history (feed_id, date, error)
+		select feed_id, datetime('now'), ifnull(error, '') from feed_errors;
+		update feeds set failures = 1 where id in (select feed_id from feed_errors);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m29_item_raw_content(tx *sql.Tx) error {
+	sql := `
+		alter table items add column raw_content text;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QueryError describes a malformed search query.
+type QueryError struct {
+	Pos     int    `json:"pos"`
+	Token   string `json:"token"`
+	Message string `json:"message"`
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s (at %d: %#v)", e.Message, e.Pos, e.Token)
+}
+
+var queryDateLayout = "2006-01-02"
+
+// ParseQuery compiles the search query into an item filter.
+//
+// Besides the full-text search syntax (see `searchQuery`) the query may contain
+// the following operators:
+//   - `feed:name`, `folder:name` limit the results to the feeds/folders whose title contains the name
+//   - `is:unread`, `is:read`, `is:starred` filter by item state (`is:unread is:starred` is fine)
+//   - `before:2006-01-02`, `after:2006-01-02` filter by item date (`after:` includes the day itself)
+//   - `author:name` filters by the author
+//   - `has:audio`, `has:image` filter items with attachments
+//
+// Values containing spaces must be quoted, e.g. `feed:"Hacker News"`.
+// The remaining words (as well as `title:` operators) end up in `ItemFilter.Search`.
+func ParseQuery(query string) (ItemFilter, error) {
+	filter := ItemFilter{}
+	terms := make([]string, 0)
+
+	for _, token := range searchTokens(query) {
+		parts := strings.SplitN(strings.TrimPrefix(token.Text, "-"), ":", 2)
+		if len(parts) != 2 || !isQueryOperator(parts[0]) || parts[0] == "title" {
+			terms = append(terms, token.Text)
+			continue
+		}
+
+		op, value := parts[0], parts[1]
+		fail := func(message string) (ItemFilter, error) {
+			return ItemFilter{}, &QueryError{Pos: token.Pos, Token: token.Text, Message: message}
+		}
+		if strings.HasPrefix(token.Text, "-") {
+			return fail(fmt.Sprintf("operator %s: cannot be negated", op))
+		}
+		if strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) && len(value) > 1 {
+			value = value[1 : len(value)-1]
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return fail(fmt.Sprintf("operator %s: requires a value", op))
+		}
+
+		switch op {
+		case "feed":
+			filter.FeedName = &value
+		case "folder":
+			filter.FolderName = &value
+		case "author":
+			filter.Author = &value
+		case "is":
+			yes := true
+			switch value {
+			case "unread", "read":
+				isRead := value == "read"
+				if filter.IsRead != nil && *filter.IsRead != isRead {
+					return fail("conflicting is: operators")
+				}
+				filter.IsRead = &isRead
+			case "starred":
+				filter.IsStarred = &yes
+			default:
+				return fail(fmt.Sprintf("is: expects one of unread, read, starred, got %#v", value))
+			}
+		case "has":
+			yes := true
+			switch value {
+			case "audio":
+				filter.HasAudio = &yes
+			case "image":
+				filter.HasImage = &yes
+			default:
+				return fail(fmt.Sprintf("has: expects one of audio, image, got %#v", value))
+			}
+		case "before", "after":
+			date, err := time.ParseInLocation(queryDateLayout, value, time.UTC)
+			if err != nil {
+				return fail(fmt.Sprintf("%s: expects a date in the YYYY-MM-DD format, got %#v", op, value))
+			}
+			if op == "before" {
+				filter.Before = &date
+			} else {
+				filter.Since = &date
+			}
+		}
+	}
+	if len(terms) > 0 {
+		search := strings.Join(terms, " ")
+		// nothing to search for in e.g. `OR` or `(`
+		if query, _ := searchQuery(search); query != "" {
+			filter.Search = &search
+		}
+	}
+	return filter, nil
+}
+
+func isQueryOperator(op string) bool {
+	switch op {
+	case "feed", "folder", "is", "before", "after", "title", "author", "has":
+		return true
+	}
+	return false
+}
+
+// likePattern builds a pattern for a case-insensitive substring match
+// (`like ? escape '\'`).
+func likePattern(val string) string {
+	val = strings.ReplaceAll(val, `\`, `\\`)
+	val = strings.ReplaceAll(val, `%`, `\%`)
+	val = strings.ReplaceAll(val, `_`, `\_`)
+	return "%" + val + "%"
+}
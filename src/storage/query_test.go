@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	filter, err := ParseQuery(`golang feed:"Hacker News" folder:tech is:unread after:2026-01-01 before:2026-02-01 author:jane has:audio title:release -title:rc`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	no, yes := false, true
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	search := "golang title:release -title:rc"
+	feedName, folderName, author := "Hacker News", "tech", "jane"
+	want := ItemFilter{
+		IsRead:     &no,
+		Search:     &search,
+		Before:     &before,
+		Since:      &since,
+		FeedName:   &feedName,
+		FolderName: &folderName,
+		Author:     &author,
+		HasAudio:   &yes,
+	}
+	if !reflect.DeepEqual(filter, want) {
+		t.Fatalf("invalid filter\nwant: %#v\nhave: %#v", want, filter)
+	}
+
+	filter, err = ParseQuery("https://example.com")
+	if err != nil || filter.Search == nil || *filter.Search != "https://example.com" {
+		t.Fatalf("expected plain search, have %#v (%v)", filter, err)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	cases := map[string]QueryError{
+		"foo is:maybe":      {Pos: 4, Token: "is:maybe"},
+		"has:video":         {Pos: 0, Token: "has:video"},
+		"before:yesterday":  {Pos: 0, Token: "before:yesterday"},
+		"feed:":             {Pos: 0, Token: "feed:"},
+		"a -feed:x":         {Pos: 2, Token: "-feed:x"},
+		"is:unread is:read": {Pos: 10, Token: "is:read"},
+		`foo folder:"" bar`: {Pos: 4, Token: `folder:""`},
+	}
+	for input, want := range cases {
+		_, err := ParseQuery(input)
+		qerr, ok := err.(*QueryError)
+		if !ok {
+			t.Errorf("expected query error for %#v, have %#v", input, err)
+			continue
+		}
+		if qerr.Pos != want.Pos || qerr.Token != want.Token || qerr.Message == "" {
+			t.Errorf("invalid error for %#v\nwant: %#v\nhave: %#v", input, want, qerr)
+		}
+	}
+}
+
+func TestListItemsQuery(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+	audio := "http://example.com/audio.mp3"
+	db.CreateItems([]Item{
+		{GUID: "item014", FeedId: scope.feed01.Id, Title: "title014", Author: "Jane Doe", AudioURL: &audio},
+	})
+	db.SyncSearch()
+
+	cases := map[string][]string{
+		"feed:FEED1":              {"item111", "item112", "item113", "item121", "item122"},
+		"folder:folder2":          {"item211", "item212"},
+		"folder:folder2 is:read":  {"item211", "item212"},
+		"author:jane":             {"item014"},
+		"has:audio":               {"item014"},
+		"title:title11 -title111": {"item112", "item113"},
+	}
+	for query, want := range cases {
+		filter, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have := getItemGuids(db.ListItems(filter, 10, false, false))
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("invalid items for %#v\nwant: %#v\nhave: %#v", query, want, have)
+		}
+	}
+}
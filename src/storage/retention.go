@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"log"
+	"sort"
+)
+
+// RetentionPolicy controls how long items of a feed are kept in the database.
+// Unset (nil) values are inherited from the parent folder(s) and eventually
+// from the global settings.
+type RetentionPolicy struct {
+	// Delete items older than the given number of days. 0 keeps items forever.
+	KeepDays *int64 `json:"keep_days"`
+	// Always keep at least the given number of the newest items, regardless of their age.
+	KeepItems *int64 `json:"keep_items"`
+	// Never keep more than the given number of the newest items. 0 means no limit.
+	MaxItems *int64 `json:"max_items"`
+}
+
+func (p RetentionPolicy) inherit(parent RetentionPolicy) RetentionPolicy {
+	if p.KeepDays == nil {
+		p.KeepDays = parent.KeepDays
+	}
+	if p.KeepItems == nil {
+		p.KeepItems = parent.KeepItems
+	}
+	if p.MaxItems == nil {
+		p.MaxItems = parent.MaxItems
+	}
+	return p
+}
+
+func (p RetentionPolicy) IsValid() bool {
+	for _, val := range []*int64{p.KeepDays, p.KeepItems, p.MaxItems} {
+		if val != nil && *val < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// LimitItems drops the items exceeding the policy's maximum, keeping the newest ones.
+// Used before storing freshly fetched items, so that the items removed by the cleanup
+// do not reappear as unread on every refresh.
+func (p RetentionPolicy) LimitItems(items []Item) []Item {
+	if p.MaxItems == nil || *p.MaxItems <= 0 || int64(len(items)) <= *p.MaxItems {
+		return items
+	}
+	sorted := make([]Item, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.After(sorted[j].Date)
+	})
+	return sorted[:*p.MaxItems]
+}
+
+func (s *Storage) UpdateFeedRetention(feedId int64, policy RetentionPolicy) bool {
+	_, err := s.db.Exec(
+		`update feeds set keep_days = ?, keep_items = ?, max_items = ? where id = ?`,
+		policy.KeepDays, policy.KeepItems, policy.MaxItems, feedId,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) UpdateFolderRetention(folderId int64, policy RetentionPolicy) bool {
+	_, err := s.db.Exec(
+		`update folders set keep_days = ?, keep_items = ?, max_items = ? where id = ?`,
+		policy.KeepDays, policy.KeepItems, policy.MaxItems, folderId,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) globalRetentionPolicy() RetentionPolicy {
+	settings := s.GetSettings()
+	value := func(key string) *int64 {
+		var val int64
+		if fval, ok := settings[key].(float64); ok {
+			val = int64(fval)
+		} else if ival, ok := settings[key].(int); ok {
+			val = int64(ival)
+		}
+		return &val
+	}
+	return RetentionPolicy{
+		KeepDays:  value("retention_keep_days"),
+		KeepItems: value("retention_keep_items"),
+		MaxItems:  value("retention_max_items"),
+	}
+}
+
+// FeedRetentionPolicies returns the effective (fully resolved) retention policy of every feed.
+func (s *Storage) FeedRetentionPolicies() map[int64]RetentionPolicy {
+	result := make(map[int64]RetentionPolicy)
+	global := s.globalRetentionPolicy()
+
+	folderParents := make(map[int64]*int64)
+	folderPolicies := make(map[int64]RetentionPolicy)
+	for _, folder := range s.ListFolders() {
+		folderParents[folder.Id] = folder.ParentId
+		folderPolicies[folder.Id] = folder.Retention
+	}
+
+	var folderPolicy func(folderId *int64, depth int) RetentionPolicy
+	folderPolicy = func(folderId *int64, depth int) RetentionPolicy {
+		// depth guards against cycles in corrupted folder trees
+		if folderId == nil || depth > len(folderParents) {
+			return global
+		}
+		return folderPolicies[*folderId].inherit(folderPolicy(folderParents[*folderId], depth+1))
+	}
+
+	for _, feed := range s.ListFeeds() {
+		result[feed.Id] = feed.Retention.inherit(folderPolicy(feed.FolderId, 0))
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func int64ptr(val int64) *int64 {
+	return &val
+}
+
+func TestFeedRetentionPolicies(t *testing.T) {
+	db := testDB()
+	folder1 := db.CreateFolder("folder1", nil)
+	folder2 := db.CreateFolder("folder2", &folder1.Id)
+	feed1 := db.CreateFeed("feed1", "", "", "http://test.com/feed1.xml", &folder2.Id)
+	feed2 := db.CreateFeed("feed2", "", "", "http://test.com/feed2.xml", nil)
+
+	db.UpdateSettings(map[string]interface{}{"retention_keep_days": 30})
+	db.UpdateFolderRetention(folder1.Id, RetentionPolicy{KeepDays: int64ptr(7), MaxItems: int64ptr(100)})
+	db.UpdateFolderRetention(folder2.Id, RetentionPolicy{MaxItems: int64ptr(10)})
+	db.UpdateFeedRetention(feed1.Id, RetentionPolicy{KeepItems: int64ptr(5)})
+
+	policies := db.FeedRetentionPolicies()
+
+	p1 := policies[feed1.Id]
+	if *p1.KeepDays != 7 || *p1.KeepItems != 5 || *p1.MaxItems != 10 {
+		t.Errorf("invalid feed1 policy: %d, %d, %d", *p1.KeepDays, *p1.KeepItems, *p1.MaxItems)
+	}
+	p2 := policies[feed2.Id]
+	if *p2.KeepDays != 30 || *p2.KeepItems != int64(itemsKeepSize) || *p2.MaxItems != 0 {
+		t.Errorf("invalid feed2 policy: %d, %d, %d", *p2.KeepDays, *p2.KeepItems, *p2.MaxItems)
+	}
+}
+
+func TestDeleteOldItemsRetention(t *testing.T) {
+	now := time.Now().UTC()
+	db := testDB()
+	forever := db.CreateFeed("forever", "", "", "http://test.com/forever.xml", nil)
+	podcast := db.CreateFeed("podcast", "", "", "http://test.com/podcast.xml", nil)
+	db.UpdateFeedRetention(forever.Id, RetentionPolicy{KeepDays: int64ptr(0), KeepItems: int64ptr(0)})
+	db.UpdateFeedRetention(podcast.Id, RetentionPolicy{MaxItems: int64ptr(10)})
+
+	items := make([]Item, 0)
+	for i := 0; i < 20; i++ {
+		istr := strconv.Itoa(i)
+		for _, feed := range []*Feed{forever, podcast} {
+			items = append(items, Item{
+				GUID:   istr,
+				FeedId: feed.Id,
+				Title:  istr,
+				Date:   now.Add(time.Hour * time.Duration(i)),
+			})
+		}
+	}
+	db.CreateItems(items)
+	db.db.Exec(`update items set date_arrived = ?`, now.Add(-time.Hour*24*365))
+
+	db.DeleteOldItems()
+
+	if have := db.CountItems(ItemFilter{FeedID: &forever.Id}); have != 20 {
+		t.Errorf("expected all items to be kept, have %d", have)
+	}
+	podcastItems := db.ListItems(ItemFilter{FeedID: &podcast.Id}, 100, true, false)
+	if len(podcastItems) != 10 || podcastItems[0].GUID != "19" || podcastItems[9].GUID != "10" {
+		t.Errorf("expected the 10 newest items to be kept, have %#v", getItemGuids(podcastItems))
+	}
+}
+
+func TestRetentionLimitItems(t *testing.T) {
+	now := time.Now()
+	items := []Item{
+		{GUID: "1", Date: now.Add(-time.Hour)},
+		{GUID: "2", Date: now},
+		{GUID: "3", Date: now.Add(-time.Minute)},
+	}
+	have := getItemGuids(RetentionPolicy{MaxItems: int64ptr(2)}.LimitItems(items))
+	if len(have) != 2 || have[0] != "2" || have[1] != "3" {
+		t.Errorf("invalid limited items: %#v", have)
+	}
+	if len(RetentionPolicy{}.LimitItems(items)) != 3 {
+		t.Error("unlimited policy must keep all items")
+	}
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"log"
+	"time"
+)
+
+// ItemRevision is a previous version of an item,
+// the one that got replaced by the publisher's edit at the given date.
+type ItemRevision struct {
+	Id      int64     `json:"id"`
+	ItemId  int64     `json:"item_id"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Date    time.Time `json:"date"`
+}
+
+// ListItemRevisions returns the item's previous versions, the oldest first.
+func (s *Storage) ListItemRevisions(itemId int64) []ItemRevision {
+	result := make([]ItemRevision, 0)
+	rows, err := s.db.Query(`
+		select id, item_id, title, content, date
+		from item_revisions
+		where item_id = ?
+		order by id
+	`, itemId)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var r ItemRevision
+		if err = rows.Scan(&r.Id, &r.ItemId, &r.Title, &r.Content, &r.Date); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, r)
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCreateItemsUpdated(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+	created := db.CreateItems([]Item{
+		{GUID: "item1", FeedId: feed.Id, Title: "title", Content: "<p>helo world</p>"},
+		{GUID: "item2", FeedId: feed.Id, Title: "untouched", Content: "content"},
+	})
+	if created != 2 {
+		t.Fatalf("expected 2 new items, have: %d", created)
+	}
+	db.SyncSearch()
+	item1 := getItem(db, "item1")
+	db.UpdateItemRead(item1.Id, true)
+
+	// refetching the same items changes nothing
+	created = db.CreateItems([]Item{
+		{GUID: "item1", FeedId: feed.Id, Title: "title", Content: "<p>helo world</p>"},
+		{GUID: "item2", FeedId: feed.Id, Title: "untouched", Content: "content"},
+	})
+	if created != 0 {
+		t.Fatalf("expected no new items, have: %d", created)
+	}
+	if revisions := db.ListItemRevisions(item1.Id); len(revisions) != 0 {
+		t.Fatalf("expected no revisions, have: %#v", revisions)
+	}
+
+	db.CreateItems([]Item{{GUID: "item1", FeedId: feed.Id, Title: "title", Content: "<p>hello world</p>"}})
+	db.SyncSearch()
+
+	have := getItem(db, "item1")
+	if have.Content != "<p>hello world</p>" || !have.IsRead {
+		t.Fatalf("expected the item to be updated (& stay read), have: %#v", have)
+	}
+	revisions := db.ListItemRevisions(item1.Id)
+	if len(revisions) != 1 || revisions[0].Title != "title" || revisions[0].Content != "<p>helo world</p>" {
+		t.Fatalf("invalid revisions: %#v", revisions)
+	}
+
+	search := "hello"
+	if guids := getItemGuids(db.ListItems(ItemFilter{Search: &search}, 10, false, false)); !reflect.DeepEqual(guids, []string{"item1"}) {
+		t.Fatalf("expected the item to be re-indexed, have: %#v", guids)
+	}
+	search = "helo"
+	if guids := getItemGuids(db.ListItems(ItemFilter{Search: &search}, 10, false, false)); len(guids) != 0 {
+		t.Fatalf("expected the previous version to be gone from the index, have: %#v", guids)
+	}
+
+	db.UpdateFeedUnreadOnUpdate(feed.Id, true)
+	if feed = db.GetFeed(feed.Id); !feed.UnreadOnUpdate {
+		t.Fatal("expected feed option to be set")
+	}
+	db.CreateItems([]Item{{GUID: "item1", FeedId: feed.Id, Title: "new title", Content: "<p>hello world</p>"}})
+	if have = getItem(db, "item1"); have.Title != "new title" || have.IsRead {
+		t.Fatalf("expected the item to be updated & marked unread, have: %#v", have)
+	}
+	if revisions = db.ListItemRevisions(item1.Id); len(revisions) != 2 || revisions[1].Content != "<p>hello world</p>" {
+		t.Fatalf("invalid revisions: %#v", revisions)
+	}
+}
+
+func TestCreateItemsFullContent(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+	summary := "<p>teaser</p>"
+	db.CreateItems([]Item{{GUID: "item1", FeedId: feed.Id, Title: "title", Content: "<p>the whole article</p>", Summary: &summary}})
+	db.SyncSearch()
+
+	if guids := db.NewItemGUIDs(feed.Id, []string{"item1", "item2"}); !reflect.DeepEqual(guids, map[string]bool{"item2": true}) {
+		t.Fatalf("invalid new guids: %#v", guids)
+	}
+
+	// the feed still has the summary, which is no news
+	db.CreateItems([]Item{{GUID: "item1", FeedId: feed.Id, Title: "title", Content: summary}})
+	item := getItem(db, "item1")
+	if item.Content != "<p>the whole article</p>" || item.Summary == nil || *item.Summary != summary {
+		t.Fatalf("expected the article to be kept, have: %#v", item)
+	}
+	if revisions := db.ListItemRevisions(item.Id); len(revisions) != 0 {
+		t.Fatalf("expected no revisions, have: %#v", revisions)
+	}
+	search := "article"
+	if guids := getItemGuids(db.ListItems(ItemFilter{Search: &search}, 10, false, false)); !reflect.DeepEqual(guids, []string{"item1"}) {
+		t.Fatalf("expected the article to be indexed, have: %#v", guids)
+	}
+
+	// the edited summary is updated, the article kept
+	db.CreateItems([]Item{{GUID: "item1", FeedId: feed.Id, Title: "title", Content: "<p>new teaser</p>"}})
+	item = getItem(db, "item1")
+	if item.Content != "<p>the whole article</p>" || item.Summary == nil || *item.Summary != "<p>new teaser</p>" {
+		t.Fatalf("expected the item to be updated, have: %#v", item)
+	}
+	revisions := db.ListItemRevisions(item.Id)
+	if len(revisions) != 1 || revisions[0].Content != summary {
+		t.Fatalf("invalid revisions: %#v", revisions)
+	}
+}
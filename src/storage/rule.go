@@ -0,0 +1,455 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+)
+
+// item fields the rules match on
+const (
+	RuleTitle      = "title"
+	RuleContent    = "content"
+	RuleAuthor     = "author"
+	RuleLink       = "link"
+	RuleCategories = "categories"
+)
+
+// ways of matching: case-insensitive substring or regular expression
+const (
+	RuleKeyword = "keyword"
+	RuleRegex   = "regex"
+)
+
+// rule actions
+const (
+	RuleMarkRead = "read"
+	RuleStar     = "star"
+	RuleLabel    = "label"
+	RuleDrop     = "drop"
+	RuleMove     = "move"
+)
+
+// Rule is applied to the new items of the feeds in its scope before they're
+// stored. The scope is the feed, the folder (with its subfolders) or,
+// if neither is given, all of the feeds.
+type Rule struct {
+	Id       int64  `json:"id"`
+	Title    string `json:"title"`
+	FeedId   *int64 `json:"feed_id"`
+	FolderId *int64 `json:"folder_id"`
+
+	Field   string `json:"field"`
+	Match   string `json:"match"`
+	Pattern string `json:"pattern"`
+
+	// the label to attach (`label`) or the folder to show the item in (`move`)
+	Action         string `json:"action"`
+	LabelId        *int64 `json:"label_id"`
+	TargetFolderId *int64 `json:"target_folder_id"`
+
+	Enabled bool `json:"enabled"`
+	// number of the items the rule has matched so far
+	Hits int64 `json:"hits"`
+
+	re *regexp.Regexp
+}
+
+func (r *Rule) Validate() error {
+	switch r.Field {
+	case RuleTitle, RuleContent, RuleAuthor, RuleLink, RuleCategories:
+	default:
+		return errors.New("field must be one of: title, content, author, link, categories")
+	}
+	if r.Pattern == "" {
+		return errors.New("pattern is required")
+	}
+	switch r.Match {
+	case RuleKeyword:
+	case RuleRegex:
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return errors.New("invalid regex: " + err.Error())
+		}
+		r.re = re
+	default:
+		return errors.New("match must be either keyword or regex")
+	}
+	switch r.Action {
+	case RuleMarkRead, RuleStar, RuleDrop:
+	case RuleLabel:
+		if r.LabelId == nil {
+			return errors.New("label action requires label_id")
+		}
+	case RuleMove:
+		if r.TargetFolderId == nil {
+			return errors.New("move action requires target_folder_id")
+		}
+	default:
+		return errors.New("action must be one of: read, star, label, drop, move")
+	}
+	if r.FeedId != nil && r.FolderId != nil {
+		return errors.New("rule may be limited to either a feed or a folder")
+	}
+	return nil
+}
+
+// Matches tells whether the rule's pattern is found in the item's field.
+func (r *Rule) Matches(item Item) bool {
+	if r.Match == RuleRegex && r.re == nil {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return false
+		}
+		r.re = re
+	}
+	var values []string
+	switch r.Field {
+	case RuleTitle:
+		values = []string{item.Title}
+	case RuleContent:
+		values = []string{htmlutil.ExtractText(item.Content)}
+	case RuleAuthor:
+		values = []string{item.Author}
+	case RuleLink:
+		values = []string{item.Link}
+	case RuleCategories:
+		values = item.Categories
+	}
+	for _, value := range values {
+		if r.Match == RuleRegex {
+			if r.re.MatchString(value) {
+				return true
+			}
+		} else if strings.Contains(strings.ToLower(value), strings.ToLower(r.Pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply performs the rule's action on the item. Returns false if the item is dropped.
+func (r *Rule) apply(item *Item) bool {
+	switch r.Action {
+	case RuleMarkRead:
+		item.IsRead = true
+	case RuleStar:
+		item.IsStarred = true
+	case RuleLabel:
+		for _, id := range item.Labels {
+			if id == *r.LabelId {
+				return true
+			}
+		}
+		item.Labels = append(item.Labels, *r.LabelId)
+	case RuleMove:
+		item.FolderId = r.TargetFolderId
+	case RuleDrop:
+		return false
+	}
+	return true
+}
+
+// applyRules runs the items through the rules (in their order).
+// Returns the items left & the number of the items each rule has matched.
+func applyRules(rules []Rule, items []Item) ([]Item, map[int64]int64) {
+	kept := make([]Item, 0, len(items))
+	hits := make(map[int64]int64)
+	for _, item := range items {
+		dropped := false
+		for i := range rules {
+			if !rules[i].Matches(item) {
+				continue
+			}
+			hits[rules[i].Id]++
+			if !rules[i].apply(&item) {
+				dropped = true
+				break
+			}
+		}
+		if !dropped {
+			kept = append(kept, item)
+		}
+	}
+	return kept, hits
+}
+
+// ApplyRules runs the feed's new items through the rules in the feed's scope.
+// The known items are left as they are, the dropped ones are remembered,
+// so that the rules handle each item only once.
+func (s *Storage) ApplyRules(feed Feed, items []Item) []Item {
+	rules := s.FeedRules(feed)
+	if len(rules) == 0 || len(items) == 0 {
+		return items
+	}
+	guids := make([]string, len(items))
+	for i, item := range items {
+		guids[i] = item.GUID
+	}
+	isNew := s.NewItemGUIDs(feed.Id, guids)
+	isDropped := s.droppedItemGUIDs(feed.Id, guids)
+
+	result := make([]Item, 0, len(items))
+	incoming := make([]Item, 0)
+	for _, item := range items {
+		switch {
+		case isDropped[item.GUID]:
+		case isNew[item.GUID]:
+			incoming = append(incoming, item)
+		default:
+			result = append(result, item)
+		}
+	}
+	kept, hits := applyRules(rules, incoming)
+
+	isKept := make(map[string]bool)
+	for _, item := range kept {
+		isKept[item.GUID] = true
+	}
+	for _, item := range incoming {
+		if !isKept[item.GUID] {
+			s.addDroppedItem(feed.Id, item.GUID)
+		}
+	}
+	s.addRuleHits(hits)
+	return append(result, kept...)
+}
+
+const ruleColumns = `
+	id, title, feed_id, folder_id, field, match, pattern,
+	action, label_id, target_folder_id, enabled, hits`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRule(row scanner) (Rule, error) {
+	var r Rule
+	err := row.Scan(
+		&r.Id, &r.Title, &r.FeedId, &r.FolderId, &r.Field, &r.Match, &r.Pattern,
+		&r.Action, &r.LabelId, &r.TargetFolderId, &r.Enabled, &r.Hits,
+	)
+	return r, err
+}
+
+func (s *Storage) listRules(predicate string, args ...interface{}) []Rule {
+	result := make([]Rule, 0)
+	rows, err := s.db.Query(`select `+ruleColumns+` from rules where `+predicate+` order by id`, args...)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+func (s *Storage) ListRules() []Rule {
+	return s.listRules("1")
+}
+
+// FeedRules returns the enabled rules whose scope includes the feed.
+func (s *Storage) FeedRules(feed Feed) []Rule {
+	return s.listRules(`
+		enabled = 1 and (
+			(feed_id is null and folder_id is null)
+			or feed_id = ?
+			or folder_id in (
+				with recursive ancestors(id) as (
+					select folder_id from feeds where id = ?
+					union
+					select f.parent_id from folders f join ancestors a on f.id = a.id
+				)
+				select id from ancestors
+			)
+		)`,
+		feed.Id, feed.Id,
+	)
+}
+
+func (s *Storage) GetRule(id int64) *Rule {
+	r, err := scanRule(s.db.QueryRow(`select `+ruleColumns+` from rules where id = ?`, id))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return &r
+}
+
+func (s *Storage) CreateRule(r Rule) *Rule {
+	err := s.db.QueryRow(`
+		insert into rules (
+			title, feed_id, folder_id, field, match, pattern,
+			action, label_id, target_folder_id, enabled
+		)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		returning id`,
+		r.Title, r.FeedId, r.FolderId, r.Field, r.Match, r.Pattern,
+		r.Action, r.LabelId, r.TargetFolderId, r.Enabled,
+	).Scan(&r.Id)
+	if err != nil {
+		log.Print(err)
+		return nil
+	}
+	r.Hits = 0
+	return &r
+}
+
+// UpdateRule saves the rule's definition (the hit counter is kept).
+func (s *Storage) UpdateRule(r Rule) bool {
+	_, err := s.db.Exec(`
+		update rules
+		set title = ?, feed_id = ?, folder_id = ?, field = ?, match = ?, pattern = ?,
+			action = ?, label_id = ?, target_folder_id = ?, enabled = ?
+		where id = ?`,
+		r.Title, r.FeedId, r.FolderId, r.Field, r.Match, r.Pattern,
+		r.Action, r.LabelId, r.TargetFolderId, r.Enabled,
+		r.Id,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) DeleteRule(id int64) bool {
+	_, err := s.db.Exec(`delete from rules where id = ?`, id)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) addRuleHits(hits map[int64]int64) {
+	for id, count := range hits {
+		if _, err := s.db.Exec(`update rules set hits = hits + ? where id = ?`, count, id); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+func (s *Storage) addDroppedItem(feedId int64, guid string) {
+	_, err := s.db.Exec(`
+		insert into dropped_items (feed_id, guid) values (?, ?)
+		on conflict (feed_id, guid) do nothing`,
+		feedId, guid,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func (s *Storage) droppedItemGUIDs(feedId int64, guids []string) map[string]bool {
+	result := make(map[string]bool)
+	args := []interface{}{feedId}
+	for _, guid := range guids {
+		args = append(args, guid)
+	}
+	rows, err := s.db.Query(`
+		select guid from dropped_items
+		where feed_id = ? and guid in (`+strings.TrimSuffix(strings.Repeat("?,", len(guids)), ",")+`)`,
+		args...,
+	)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var guid string
+		if err = rows.Scan(&guid); err != nil {
+			log.Print(err)
+			return result
+		}
+		result[guid] = true
+	}
+	return result
+}
+
+// MatchRule tells which of the stored items in the rule's scope the rule
+// would have matched (the latest first, up to the limit), & how many in total.
+func (s *Storage) MatchRule(r Rule, limit int) ([]Item, int) {
+	matched := make([]Item, 0)
+	total := 0
+
+	predicate, args := "1", []interface{}{}
+	if r.FeedId != nil {
+		predicate, args = "i.feed_id = ?", []interface{}{*r.FeedId}
+	} else if r.FolderId != nil {
+		predicate = "i.feed_id in (select id from feeds where folder_id in (" + folderTreeQuery + "))"
+		args = []interface{}{*r.FolderId}
+	}
+	rows, err := s.db.Query(`
+		select
+			i.id, i.guid, i.feed_id, i.title, i.link, ifnull(i.author, ''),
+			ifnull(i.content, ''), ifnull(i.categories, ''),
+			i.date, i.is_read, i.is_starred
+		from items i
+		where `+predicate+`
+		order by i.date desc, i.id desc`,
+		args...,
+	)
+	if err != nil {
+		log.Print(err)
+		return matched, total
+	}
+	for rows.Next() {
+		var item Item
+		var categories string
+		err = rows.Scan(
+			&item.Id, &item.GUID, &item.FeedId, &item.Title, &item.Link, &item.Author,
+			&item.Content, &categories,
+			&item.Date, &item.IsRead, &item.IsStarred,
+		)
+		if err != nil {
+			log.Print(err)
+			return matched, total
+		}
+		item.Categories = decodeCategories(categories)
+		if !r.Matches(item) {
+			continue
+		}
+		total++
+		if len(matched) < limit {
+			item.Content = ""
+			matched = append(matched, item)
+		}
+	}
+	return matched, total
+}
+
+func encodeCategories(categories []string) *string {
+	if len(categories) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(categories)
+	if err != nil {
+		log.Print(err)
+		return nil
+	}
+	value := string(data)
+	return &value
+}
+
+func decodeCategories(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var categories []string
+	if err := json.Unmarshal([]byte(value), &categories); err != nil {
+		log.Print(err)
+	}
+	return categories
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRuleValidate(t *testing.T) {
+	invalid := []Rule{
+		{Field: "guid", Match: RuleKeyword, Pattern: "x", Action: RuleMarkRead},
+		{Field: RuleTitle, Match: RuleKeyword, Pattern: "", Action: RuleMarkRead},
+		{Field: RuleTitle, Match: RuleRegex, Pattern: "(", Action: RuleMarkRead},
+		{Field: RuleTitle, Match: RuleKeyword, Pattern: "x", Action: RuleLabel},
+		{Field: RuleTitle, Match: RuleKeyword, Pattern: "x", Action: RuleMove},
+		{Field: RuleTitle, Match: RuleKeyword, Pattern: "x", Action: "delete"},
+	}
+	for _, rule := range invalid {
+		if rule.Validate() == nil {
+			t.Errorf("expected rule to be invalid: %#v", rule)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	item := Item{
+		Title:      "Release Notes: Go 1.17",
+		Content:    "<p>Generic <b>types</b> are coming</p>",
+		Author:     "Jane Doe",
+		Link:       "http://example.com/go/1.17",
+		Categories: []string{"golang", "Releases"},
+	}
+	testcases := []struct {
+		rule Rule
+		want bool
+	}{
+		{Rule{Field: RuleTitle, Match: RuleKeyword, Pattern: "release notes"}, true},
+		{Rule{Field: RuleTitle, Match: RuleKeyword, Pattern: "rust"}, false},
+		{Rule{Field: RuleContent, Match: RuleKeyword, Pattern: "generic types"}, true},
+		{Rule{Field: RuleContent, Match: RuleKeyword, Pattern: "<b>"}, false},
+		{Rule{Field: RuleAuthor, Match: RuleRegex, Pattern: `^Jane\b`}, true},
+		{Rule{Field: RuleLink, Match: RuleRegex, Pattern: `/go/\d`}, true},
+		{Rule{Field: RuleCategories, Match: RuleKeyword, Pattern: "releases"}, true},
+		{Rule{Field: RuleCategories, Match: RuleRegex, Pattern: "^go$"}, false},
+	}
+	for _, tc := range testcases {
+		if have := tc.rule.Matches(item); have != tc.want {
+			t.Errorf("%s %s %q: want %v, have %v", tc.rule.Field, tc.rule.Match, tc.rule.Pattern, tc.want, have)
+		}
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	db := testDB()
+	folder := db.CreateFolder("folder", nil)
+	subfolder := db.CreateFolder("subfolder", &folder.Id)
+	target := db.CreateFolder("target", nil)
+	label := db.CreateLabel("label")
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", &subfolder.Id)
+	other := db.CreateFeed("other", "", "", "http://example.com/other.xml", nil)
+
+	drop := db.CreateRule(Rule{Field: RuleTitle, Match: RuleKeyword, Pattern: "sponsored", Action: RuleDrop, Enabled: true})
+	star := db.CreateRule(Rule{FolderId: &folder.Id, Field: RuleAuthor, Match: RuleKeyword, Pattern: "jane", Action: RuleStar, Enabled: true})
+	db.CreateRule(Rule{FeedId: &feed.Id, Field: RuleTitle, Match: RuleRegex, Pattern: "^Weekly", Action: RuleLabel, LabelId: &label.Id, Enabled: true})
+	db.CreateRule(Rule{FeedId: &feed.Id, Field: RuleTitle, Match: RuleRegex, Pattern: "^Weekly", Action: RuleMove, TargetFolderId: &target.Id, Enabled: true})
+	db.CreateRule(Rule{Field: RuleTitle, Match: RuleKeyword, Pattern: "weekly", Action: RuleMarkRead, Enabled: false})
+
+	if rules := db.FeedRules(*other); len(rules) != 1 || rules[0].Id != drop.Id {
+		t.Fatalf("invalid rules of the feed outside the folder: %#v", rules)
+	}
+	if rules := db.FeedRules(*feed); len(rules) != 4 {
+		t.Fatalf("invalid rules of the feed: %#v", rules)
+	}
+
+	now := time.Now()
+	items := []Item{
+		{GUID: "1", FeedId: feed.Id, Title: "Weekly digest", Author: "Jane", Date: now},
+		{GUID: "2", FeedId: feed.Id, Title: "Sponsored: buy now", Author: "Jane", Date: now},
+		{GUID: "3", FeedId: feed.Id, Title: "Regular post", Date: now},
+	}
+	items = db.ApplyRules(*feed, items)
+	if have, want := getItemGuids(items), []string{"1", "3"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("invalid items\nwant: %#v\nhave: %#v", want, have)
+	}
+	db.CreateItems(items)
+
+	item := db.GetItem(getItem(db, "1").Id)
+	if !item.IsStarred || item.IsRead || !reflect.DeepEqual(item.Labels, []int64{label.Id}) || item.FolderId == nil || *item.FolderId != target.Id {
+		t.Fatalf("rules not applied: %#v", item)
+	}
+	if have := getItemGuids(db.ListItems(ItemFilter{FolderID: &target.Id}, 10, false, false)); !reflect.DeepEqual(have, []string{"1"}) {
+		t.Fatalf("expected item to be moved, have: %#v", have)
+	}
+	if have := getItemGuids(db.ListItems(ItemFilter{FolderID: &folder.Id}, 10, false, false)); !reflect.DeepEqual(have, []string{"3"}) {
+		t.Fatalf("expected item to be moved out of the folder, have: %#v", have)
+	}
+	if rule := db.GetRule(drop.Id); rule.Hits != 1 {
+		t.Fatalf("invalid drop hits: %d", rule.Hits)
+	}
+	// the dropped item is not passed to the rules after the drop
+	if rule := db.GetRule(star.Id); rule.Hits != 1 {
+		t.Fatalf("invalid star hits: %d", rule.Hits)
+	}
+
+	// the known & dropped items are left alone on the next refresh
+	items = db.ApplyRules(*feed, []Item{
+		{GUID: "1", FeedId: feed.Id, Title: "Weekly digest", Date: now},
+		{GUID: "2", FeedId: feed.Id, Title: "Sponsored: buy now", Date: now},
+	})
+	if have := getItemGuids(items); !reflect.DeepEqual(have, []string{"1"}) || items[0].IsStarred {
+		t.Fatalf("invalid items on refresh: %#v", items)
+	}
+	if rule := db.GetRule(drop.Id); rule.Hits != 1 {
+		t.Fatalf("dropped item counted twice: %d", rule.Hits)
+	}
+}
+
+func TestMatchRule(t *testing.T) {
+	db := testDB()
+	folder := db.CreateFolder("folder", nil)
+	feed1 := db.CreateFeed("feed1", "", "", "http://example.com/feed1.xml", &folder.Id)
+	feed2 := db.CreateFeed("feed2", "", "", "http://example.com/feed2.xml", nil)
+	now := time.Now()
+	db.CreateItems([]Item{
+		{GUID: "1", FeedId: feed1.Id, Title: "Go 1.16", Date: now.Add(-time.Hour)},
+		{GUID: "2", FeedId: feed1.Id, Title: "Go 1.17", Content: "release", Date: now},
+		{GUID: "3", FeedId: feed2.Id, Title: "Go 1.18", Date: now},
+		{GUID: "4", FeedId: feed2.Id, Title: "Rust", Date: now},
+	})
+
+	rule := Rule{Field: RuleTitle, Match: RuleRegex, Pattern: `^Go`}
+	items, total := db.MatchRule(rule, 2)
+	if total != 3 || len(items) != 2 {
+		t.Fatalf("invalid matches: %d %#v", total, items)
+	}
+	rule.FolderId = &folder.Id
+	items, total = db.MatchRule(rule, 10)
+	if have := getItemGuids(items); total != 2 || !reflect.DeepEqual(have, []string{"2", "1"}) {
+		t.Fatalf("invalid folder matches: %d %#v", total, have)
+	}
+	if items[0].Content != "" {
+		t.Fatal("expected no content in dry run results")
+	}
+}
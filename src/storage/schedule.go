@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"log"
+	"time"
+)
+
+// used when the automatic refresh is off (the refresh rate isn't set)
+const defaultMinRefreshInterval = 10 * time.Minute
+
+// number of the latest items the posting frequency is estimated from
+const postingIntervalItems = 10
+
+// RefreshBounds returns the limits of the adaptive refresh interval:
+// the refresh rate & the `refresh_max_interval` setting.
+func (s *Storage) RefreshBounds() (time.Duration, time.Duration) {
+	min := time.Minute * time.Duration(s.GetSettingsValueInt64("refresh_rate"))
+	max := time.Minute * time.Duration(s.GetSettingsValueInt64("refresh_max_interval"))
+	if min <= 0 {
+		min = defaultMinRefreshInterval
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+// the longest a repeatedly failing feed is put off for
+// (unless its interval is even longer)
+const maxFailureInterval = 24 * time.Hour
+
+// FeedRefreshInterval picks how long to wait before fetching the feed again.
+// Unless the feed has its own interval, it's the average time between
+// the feed's latest items, bounded by `RefreshBounds`.
+// Feeds with too few (dated) items, or pushed by a WebSub hub,
+// are refreshed as rarely as allowed.
+// The interval doubles with every failure in a row after the first one,
+// up to `maxFailureInterval`.
+func (s *Storage) FeedRefreshInterval(feed Feed) time.Duration {
+	return failureBackoff(s.feedRefreshInterval(feed), feed.Failures)
+}
+
+func failureBackoff(interval time.Duration, failures int) time.Duration {
+	if failures < 2 || interval >= maxFailureInterval {
+		return interval
+	}
+	for i := 1; i < failures && interval < maxFailureInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxFailureInterval {
+		interval = maxFailureInterval
+	}
+	return interval
+}
+
+func (s *Storage) feedRefreshInterval(feed Feed) time.Duration {
+	if feed.RefreshInterval != nil && *feed.RefreshInterval > 0 {
+		return time.Minute * time.Duration(*feed.RefreshInterval)
+	}
+	min, max := s.RefreshBounds()
+	if websub := s.GetWebSub(feed.Id); websub != nil && websub.Active(time.Now()) {
+		return max
+	}
+
+	interval := max
+	if posting, ok := s.feedPostingInterval(feed.Id); ok {
+		interval = posting
+	}
+	if interval < min {
+		interval = min
+	}
+	if interval > max {
+		interval = max
+	}
+	return interval
+}
+
+func (s *Storage) feedPostingInterval(feedId int64) (time.Duration, bool) {
+	rows, err := s.db.Query(`
+		select date from items
+		where feed_id = ?
+		order by date desc
+		limit ?
+	`, feedId, postingIntervalItems)
+	if err != nil {
+		log.Print(err)
+		return 0, false
+	}
+	dates := make([]time.Time, 0)
+	for rows.Next() {
+		var date time.Time
+		if err = rows.Scan(&date); err != nil {
+			log.Print(err)
+			return 0, false
+		}
+		if !date.IsZero() {
+			dates = append(dates, date)
+		}
+	}
+	if len(dates) < 2 {
+		return 0, false
+	}
+	return dates[0].Sub(dates[len(dates)-1]) / time.Duration(len(dates)-1), true
+}
+
+func (s *Storage) ScheduleFeedRefresh(feedId int64, at time.Time) bool {
+	_, err := s.db.Exec(`update feeds set next_fetch = ? where id = ?`, at.UTC(), feedId)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+// UpdateFeedRefreshInterval sets (or resets to the adaptive one, if nil)
+// the feed's refresh interval. The feed becomes due right away,
+// so that the new interval takes effect.
+func (s *Storage) UpdateFeedRefreshInterval(feedId int64, minutes *int64) bool {
+	_, err := s.db.Exec(`
+		update feeds set refresh_interval = ?, next_fetch = null where id = ?`,
+		minutes, feedId,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+// ListFeedsDue returns the feeds that haven't been scheduled yet,
+// or whose next fetch time has come, leaving out the paused ones & the ones
+// whose servers asked not to be fetched until later (see `SetHTTPNextAllowed`).
+func (s *Storage) ListFeedsDue(now time.Time) []Feed {
+	return s.listFeeds(`
+		paused = 0 and (next_fetch is null or next_fetch <= ?) and not exists (
+			select 1 from http_states h
+			where h.feed_id = feeds.id and h.next_allowed > ?
+		)`,
+		now.UTC(), now.UTC(),
+	)
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFeedRefreshInterval(t *testing.T) {
+	db := testDB()
+	db.UpdateSettings(map[string]interface{}{"refresh_rate": 30, "refresh_max_interval": 24 * 60})
+
+	now := time.Now().UTC()
+	daily := db.CreateFeed("daily", "", "", "http://test.com/daily.xml", nil)
+	hourly := db.CreateFeed("hourly", "", "", "http://test.com/hourly.xml", nil)
+	monthly := db.CreateFeed("monthly", "", "", "http://test.com/monthly.xml", nil)
+	quiet := db.CreateFeed("quiet", "", "", "http://test.com/quiet.xml", nil)
+	items := make([]Item, 0)
+	for i := 0; i < 20; i++ {
+		items = append(items,
+			Item{GUID: "daily" + string(rune('a'+i)), FeedId: daily.Id, Date: now.Add(-time.Hour * 6 * time.Duration(i))},
+			Item{GUID: "hourly" + string(rune('a'+i)), FeedId: hourly.Id, Date: now.Add(-time.Hour * time.Duration(i))},
+			Item{GUID: "monthly" + string(rune('a'+i)), FeedId: monthly.Id, Date: now.AddDate(0, -i, 0)},
+		)
+	}
+	items = append(items, Item{GUID: "quiet", FeedId: quiet.Id, Date: now})
+	db.CreateItems(items)
+
+	testcases := []struct {
+		feed *Feed
+		want time.Duration
+	}{
+		{daily, time.Hour * 6},
+		{hourly, time.Hour},
+		{monthly, time.Hour * 24},
+		{quiet, time.Hour * 24},
+	}
+	for _, testcase := range testcases {
+		if have := db.FeedRefreshInterval(*testcase.feed); have != testcase.want {
+			t.Errorf("invalid interval for %s\nwant: %s\nhave: %s", testcase.feed.Title, testcase.want, have)
+		}
+	}
+
+	// bounded by the refresh rate
+	db.UpdateSettings(map[string]interface{}{"refresh_rate": 120})
+	if have := db.FeedRefreshInterval(*hourly); have != time.Hour*2 {
+		t.Errorf("expected the interval to be bounded by the refresh rate, have: %s", have)
+	}
+
+	// manual override
+	minutes := int64(5)
+	db.UpdateFeedRefreshInterval(hourly.Id, &minutes)
+	if have := db.FeedRefreshInterval(*db.GetFeed(hourly.Id)); have != time.Minute*5 {
+		t.Errorf("expected the feed's own interval, have: %s", have)
+	}
+}
+
+func TestFeedRefreshIntervalFailures(t *testing.T) {
+	db := testDB()
+	db.UpdateSettings(map[string]interface{}{"refresh_rate": 30, "refresh_max_interval": 24 * 60})
+	minutes := int64(60)
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+	db.UpdateFeedRefreshInterval(feed.Id, &minutes)
+	feed = db.GetFeed(feed.Id)
+
+	testcases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, time.Hour},
+		{1, time.Hour},
+		{2, time.Hour * 2},
+		{3, time.Hour * 4},
+		{6, time.Hour * 24},
+		{100, time.Hour * 24},
+	}
+	for _, testcase := range testcases {
+		feed.Failures = testcase.failures
+		if have := db.FeedRefreshInterval(*feed); have != testcase.want {
+			t.Errorf("invalid interval for %d failures\nwant: %s\nhave: %s", testcase.failures, testcase.want, have)
+		}
+	}
+
+	// the intervals longer than the limit aren't shortened
+	minutes = 48 * 60
+	db.UpdateFeedRefreshInterval(feed.Id, &minutes)
+	feed = db.GetFeed(feed.Id)
+	feed.Failures = 3
+	if have := db.FeedRefreshInterval(*feed); have != time.Hour*48 {
+		t.Errorf("expected the feed's own interval, have: %s", have)
+	}
+}
+
+func TestListFeedsDue(t *testing.T) {
+	db := testDB()
+	now := time.Now()
+	feed1 := db.CreateFeed("feed1", "", "", "http://test.com/feed1.xml", nil)
+	feed2 := db.CreateFeed("feed2", "", "", "http://test.com/feed2.xml", nil)
+	feed3 := db.CreateFeed("feed3", "", "", "http://test.com/feed3.xml", nil)
+
+	db.ScheduleFeedRefresh(feed1.Id, now.Add(-time.Minute))
+	db.ScheduleFeedRefresh(feed2.Id, now.Add(time.Hour))
+
+	have := make([]string, 0)
+	for _, feed := range db.ListFeedsDue(now) {
+		have = append(have, feed.Title)
+	}
+	want := []string{"feed1", "feed3"}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("invalid due feeds\nwant: %#v\nhave: %#v", want, have)
+	}
+
+	// changing the interval reschedules the feed
+	minutes := int64(60)
+	db.UpdateFeedRefreshInterval(feed2.Id, &minutes)
+	if len(db.ListFeedsDue(now)) != 3 {
+		t.Fatal("expected the feed to be due after the interval change")
+	}
+	if feed := db.GetFeed(feed3.Id); feed.NextFetch != nil {
+		t.Fatalf("expected unscheduled feed, have: %v", feed.NextFetch)
+	}
+}
+
+func TestListFeedsDueNextAllowed(t *testing.T) {
+	db := testDB()
+	now := time.Now()
+	feed1 := db.CreateFeed("feed1", "", "", "http://test.com/feed1.xml", nil)
+	feed2 := db.CreateFeed("feed2", "", "", "http://test.com/feed2.xml", nil)
+
+	db.SetHTTPState(feed1.Id, "Wed, 21 Oct 2015 07:28:00 GMT", "")
+	db.SetHTTPNextAllowed(feed1.Id, now.Add(time.Hour))
+	db.SetHTTPNextAllowed(feed2.Id, now.Add(-time.Minute))
+
+	have := make([]string, 0)
+	for _, feed := range db.ListFeedsDue(now) {
+		have = append(have, feed.Title)
+	}
+	want := []string{"feed2"}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("invalid due feeds\nwant: %#v\nhave: %#v", want, have)
+	}
+
+	state := db.GetHTTPState(feed1.Id)
+	if state.LastModified != "Wed, 21 Oct 2015 07:28:00 GMT" {
+		t.Errorf("expected http state to be kept, have: %#v", state)
+	}
+	if state.NextAllowed == nil || state.NextAllowed.Unix() != now.Add(time.Hour).Unix() {
+		t.Errorf("invalid next allowed time: %v", state.NextAllowed)
+	}
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// searchQuery translates the user's search input into an FTS5 query.
+//
+// Supported syntax:
+//   - `word` matches words starting with "word"
+//   - `"some phrase"` matches the exact phrase
+//   - `a OR b`, `a AND b`, `a NOT b` are passed to FTS5 as is
+//   - `-word` excludes items containing the word (same as `NOT word`)
+//   - `title:word`, `title:"some phrase"` match the title only
+//   - `(a OR b) c` groups the terms
+//
+// Everything else is quoted, so that the input never produces an FTS5 syntax error.
+// The input made of exclusions only (e.g. `-spam`) has no terms to match the items by,
+// so the query returned matches the items to leave out, and `negated` is set.
+// The query is empty if there's nothing to search for (e.g. `OR`).
+func searchQuery(input string) (query string, negated bool) {
+	type group struct {
+		terms    []string
+		excluded []string
+		operator string
+	}
+	// the groups opened so far, the outermost one is the query itself
+	groups := []*group{{}}
+
+	closeGroup := func() string {
+		g := groups[len(groups)-1]
+		groups = groups[:len(groups)-1]
+		if len(g.terms) == 0 {
+			// the exclusions alone apply to the enclosing group
+			if len(groups) > 0 {
+				parent := groups[len(groups)-1]
+				parent.excluded = append(parent.excluded, g.excluded...)
+			}
+			return ""
+		}
+		expr := strings.Join(g.terms, " ")
+		if len(g.excluded) > 0 {
+			// NOT binds tighter than AND & OR in FTS5
+			expr = "( " + expr + " )"
+			for _, term := range g.excluded {
+				expr += " NOT " + term
+			}
+		}
+		return expr
+	}
+	addTerm := func(term string) {
+		g := groups[len(groups)-1]
+		// FTS5 only accepts the implicit AND between phrases, not next to a group
+		if g.operator == "" && len(g.terms) > 0 &&
+			(strings.HasPrefix(term, "(") || strings.HasPrefix(g.terms[len(g.terms)-1], "(")) {
+			g.operator = "AND"
+		}
+		if g.operator != "" {
+			g.terms = append(g.terms, g.operator)
+			g.operator = ""
+		}
+		g.terms = append(g.terms, term)
+	}
+
+	for _, token := range searchTokens(input) {
+		g := groups[len(groups)-1]
+		switch {
+		case token.Text == "(":
+			groups = append(groups, &group{})
+		case token.Text == ")":
+			// unbalanced parens are ignored
+			if len(groups) > 1 {
+				if expr := closeGroup(); expr != "" {
+					addTerm("( " + expr + " )")
+				}
+			}
+		case token.Text == "OR" || token.Text == "AND" || token.Text == "NOT":
+			// operators are only meaningful between terms
+			if len(g.terms) > 0 {
+				g.operator = token.Text
+			}
+		case strings.HasPrefix(token.Text, "-") && len(token.Text) > 1:
+			g.excluded = append(g.excluded, searchTerm(token.Text[1:]))
+		default:
+			addTerm(searchTerm(token.Text))
+		}
+	}
+	for len(groups) > 1 {
+		if expr := closeGroup(); expr != "" {
+			addTerm("( " + expr + " )")
+		}
+	}
+	if g := groups[0]; len(g.terms) == 0 {
+		return strings.Join(g.excluded, " OR "), len(g.excluded) > 0
+	}
+	return closeGroup(), false
+}
+
+type searchToken struct {
+	Text string
+	Pos  int
+}
+
+// searchTokens splits the input into words, double-quoted phrases & parens.
+// Phrases keep their surrounding quotes, and stick to the preceding
+// `operator:` prefix if there is one (e.g. `feed:"Hacker News"`).
+func searchTokens(input string) []searchToken {
+	tokens := make([]searchToken, 0)
+	var token strings.Builder
+	start := 0
+	inPhrase := false
+
+	flush := func() {
+		if token.Len() > 0 {
+			tokens = append(tokens, searchToken{Text: token.String(), Pos: start})
+			token.Reset()
+		}
+	}
+	for pos, r := range input {
+		switch {
+		case r == '"':
+			if inPhrase {
+				token.WriteRune(r)
+				flush()
+			} else {
+				if !strings.HasSuffix(token.String(), ":") {
+					flush()
+				}
+				if token.Len() == 0 {
+					start = pos
+				}
+				token.WriteRune(r)
+			}
+			inPhrase = !inPhrase
+		case unicode.IsSpace(r) && !inPhrase:
+			flush()
+		case (r == '(' || r == ')') && !inPhrase:
+			flush()
+			start = pos
+			token.WriteRune(r)
+			flush()
+		default:
+			if token.Len() == 0 {
+				start = pos
+			}
+			token.WriteRune(r)
+		}
+	}
+	if inPhrase {
+		token.WriteRune('"')
+	}
+	flush()
+	return tokens
+}
+
+func searchTerm(token string) string {
+	if strings.HasPrefix(token, "title:") && len(token) > len("title:") {
+		return "title : " + searchTerm(token[len("title:"):])
+	}
+	if strings.HasPrefix(token, `"`) && strings.HasSuffix(token, `"`) && len(token) > 1 {
+		phrase := strings.TrimSpace(token[1 : len(token)-1])
+		return `"` + strings.ReplaceAll(phrase, `"`, `""`) + `"`
+	}
+	return `"` + strings.ReplaceAll(token, `"`, `""`) + `"*`
+}
+
+// highlightSnippet escapes the snippet returned by FTS5
+// and wraps the matches (delimited by \x02 & \x03) in <mark> tags.
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, "\x02", "<mark>")
+	snippet = strings.ReplaceAll(snippet, "\x03", "</mark>")
+	return snippet
+}
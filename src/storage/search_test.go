@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchQuery(t *testing.T) {
+	cases := map[string]string{
+		"":                     ``,
+		"foo":                  `"foo"*`,
+		"foo bar":              `"foo"* "bar"*`,
+		`"foo bar" baz`:        `"foo bar" "baz"*`,
+		"foo OR bar":           `"foo"* OR "bar"*`,
+		"foo NOT bar":          `"foo"* NOT "bar"*`,
+		"OR foo AND":           `"foo"*`,
+		"OR":                   ``,
+		"(":                    ``,
+		"foo -bar baz":         `( "foo"* "baz"* ) NOT "bar"*`,
+		"a OR b -c":            `( "a"* OR "b"* ) NOT "c"*`,
+		`c++ a:b "unclosed`:    `"c++"* "a:b"* "unclosed"`,
+		`title:"a b" -title:c`: `( title : "a b" ) NOT title : "c"*`,
+		`say "hi"there`:        `"say"* "hi" "there"*`,
+		`"quo""te"`:            `"quo" "te"`,
+		"(a OR b) c":           `( "a"* OR "b"* ) AND "c"*`,
+		"a OR (b -c)":          `"a"* OR ( ( "b"* ) NOT "c"* )`,
+		"(a (b) OR":            `( "a"* AND ( "b"* ) )`,
+		") a () (-b)":          `( "a"* ) NOT "b"*`,
+		"(-foo) bar":           `( "bar"* ) NOT "foo"*`,
+		`"(a)" f(x)`:           `"(a)" "f"* AND ( "x"* )`,
+	}
+	for input, want := range cases {
+		if have, negated := searchQuery(input); have != want || negated {
+			t.Errorf("invalid query for %#v\nwant: %#v\nhave: %#v (negated: %v)", input, want, have, negated)
+		}
+	}
+
+	// exclusions only
+	negatedCases := map[string]string{
+		"-bar":      `"bar"*`,
+		"-a (-b) (": `"a"* OR "b"*`,
+	}
+	for input, want := range negatedCases {
+		if have, negated := searchQuery(input); have != want || !negated {
+			t.Errorf("invalid query for %#v\nwant: %#v (negated)\nhave: %#v (negated: %v)", input, want, have, negated)
+		}
+	}
+}
+
+func TestSearchItems(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+	db.CreateItems([]Item{
+		{GUID: "item1", FeedId: feed.Id, Title: "weekly digest", Content: "<p>nothing about go here</p>"},
+		{GUID: "item2", FeedId: feed.Id, Title: "release notes", Content: "<p>the new &lt;sqlite&gt; release</p>"},
+		{GUID: "item3", FeedId: feed.Id, Title: "sqlite release", Content: "<p>sqlite 3</p>"},
+	})
+	db.SyncSearch()
+
+	search := "sqlite release"
+	have := getItemGuids(db.SearchItems(ItemFilter{Search: &search}, 10, 0))
+	want := []string{"item3", "item2"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+
+	search = `"new sqlite" OR digest`
+	have = getItemGuids(db.ListItems(ItemFilter{Search: &search}, 10, false, false))
+	want = []string{"item1", "item2"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+
+	search = "sqlite -notes"
+	items := db.SearchItems(ItemFilter{Search: &search}, 10, 0)
+	if len(items) != 1 || items[0].GUID != "item3" {
+		t.Fatalf("invalid search results: %#v", getItemGuids(items))
+	}
+	if have := db.CountItems(ItemFilter{Search: &search}); have != 1 {
+		t.Errorf("invalid search count: %d", have)
+	}
+
+	search = "sqlite OR digest -notes"
+	have = getItemGuids(db.ListItems(ItemFilter{Search: &search}, 10, false, false))
+	want = []string{"item1", "item3"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("expected the exclusion to apply to both terms\nwant: %#v\nhave: %#v", want, have)
+	}
+
+	// exclusions only
+	search = "-sqlite"
+	have = getItemGuids(db.ListItems(ItemFilter{Search: &search}, 10, false, false))
+	want = []string{"item1"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("invalid results for exclusions only\nwant: %#v\nhave: %#v", want, have)
+	}
+	if have := getItemGuids(db.SearchItems(ItemFilter{Search: &search}, 10, 0)); !reflect.DeepEqual(have, want) {
+		t.Errorf("invalid search results for exclusions only\nwant: %#v\nhave: %#v", want, have)
+	}
+
+	// nothing to search for
+	for _, input := range []string{"OR", "("} {
+		search = input
+		if have := db.ListItems(ItemFilter{Search: &search}, 10, false, false); len(have) != 3 {
+			t.Errorf("expected all items for %#v, have: %#v", input, getItemGuids(have))
+		}
+		if filter, err := ParseQuery(input); err != nil || filter.Search != nil {
+			t.Errorf("expected no search for %#v, have: %#v %v", input, filter.Search, err)
+		}
+	}
+
+	search = "new"
+	items = db.ListItems(ItemFilter{Search: &search}, 10, false, false)
+	if want := "the <mark>new</mark> &lt;sqlite&gt; release"; len(items) != 1 || items[0].Snippet != want {
+		t.Errorf("invalid snippet\nwant: %#v\nhave: %#v", want, items)
+	}
+}
@@ -16,6 +16,14 @@ func settingsDefaults() map[string]interface{} {
 		"theme_font":        "",
 		"theme_size":        1,
 		"refresh_rate":      0,
+
+		// bounds of the adaptive refresh interval (in minutes),
+		// the refresh rate being the lower one
+		"refresh_max_interval": 24 * 60,
+
+		"retention_keep_days":  itemsKeepDays,
+		"retention_keep_items": itemsKeepSize,
+		"retention_max_items":  0,
 	}
 }
 
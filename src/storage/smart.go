@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"log"
+)
+
+// SmartFolder is a saved search: a query (see `ParseQuery`),
+// optionally limited to a single feed or folder.
+type SmartFolder struct {
+	Id       int64  `json:"id"`
+	Title    string `json:"title"`
+	Query    string `json:"query"`
+	FeedId   *int64 `json:"feed_id"`
+	FolderId *int64 `json:"folder_id"`
+}
+
+// ItemFilter builds the filter selecting the smart folder's items,
+// narrowed down by the extra query (e.g. the one typed into the search box).
+// Operators in the extra query take precedence over the saved ones.
+func (f SmartFolder) ItemFilter(extraQuery string) (ItemFilter, error) {
+	filter, err := ParseQuery(f.Query)
+	if err != nil {
+		return filter, err
+	}
+	extra, err := ParseQuery(extraQuery)
+	if err != nil {
+		return extra, err
+	}
+	filter.FeedID = f.FeedId
+	filter.FolderID = f.FolderId
+
+	if filter.Search != nil && extra.Search != nil {
+		// grouped so that `OR`s in the saved query don't swallow the extra terms
+		search := "(" + *filter.Search + ") " + *extra.Search
+		filter.Search = &search
+	} else if extra.Search != nil {
+		filter.Search = extra.Search
+	}
+	if extra.IsRead != nil {
+		filter.IsRead = extra.IsRead
+	}
+	if extra.IsStarred != nil {
+		filter.IsStarred = extra.IsStarred
+	}
+	if extra.Before != nil {
+		filter.Before = extra.Before
+	}
+	if extra.Since != nil {
+		filter.Since = extra.Since
+	}
+	if extra.FeedName != nil {
+		filter.FeedName = extra.FeedName
+	}
+	if extra.FolderName != nil {
+		filter.FolderName = extra.FolderName
+	}
+	if extra.Author != nil {
+		filter.Author = extra.Author
+	}
+	if extra.HasAudio != nil {
+		filter.HasAudio = extra.HasAudio
+	}
+	if extra.HasImage != nil {
+		filter.HasImage = extra.HasImage
+	}
+	return filter, nil
+}
+
+func (s *Storage) CreateSmartFolder(title, query string, feedId, folderId *int64) *SmartFolder {
+	row := s.db.QueryRow(`
+		insert into smart_folders (title, query, feed_id, folder_id)
+		values (?, ?, ?, ?)
+		returning id`,
+		title, query, feedId, folderId,
+	)
+	var id int64
+	if err := row.Scan(&id); err != nil {
+		log.Print(err)
+		return nil
+	}
+	return &SmartFolder{Id: id, Title: title, Query: query, FeedId: feedId, FolderId: folderId}
+}
+
+func (s *Storage) GetSmartFolder(id int64) *SmartFolder {
+	var f SmartFolder
+	err := s.db.QueryRow(`
+		select id, title, query, feed_id, folder_id
+		from smart_folders
+		where id = ?
+	`, id).Scan(&f.Id, &f.Title, &f.Query, &f.FeedId, &f.FolderId)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+func (s *Storage) UpdateSmartFolder(f SmartFolder) bool {
+	_, err := s.db.Exec(`
+		update smart_folders
+		set title = ?, query = ?, feed_id = ?, folder_id = ?
+		where id = ?`,
+		f.Title, f.Query, f.FeedId, f.FolderId, f.Id,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) DeleteSmartFolder(id int64) bool {
+	_, err := s.db.Exec(`delete from smart_folders where id = ?`, id)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) ListSmartFolders() []SmartFolder {
+	result := make([]SmartFolder, 0)
+	rows, err := s.db.Query(`
+		select id, title, query, feed_id, folder_id
+		from smart_folders
+		order by title collate nocase
+	`)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var f SmartFolder
+		if err = rows.Scan(&f.Id, &f.Title, &f.Query, &f.FeedId, &f.FolderId); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+type SmartFolderStat struct {
+	SmartFolderId int64 `json:"smart_folder_id"`
+	UnreadCount   int64 `json:"unread"`
+}
+
+func (s *Storage) SmartFolderStats() []SmartFolderStat {
+	result := make([]SmartFolderStat, 0)
+	for _, folder := range s.ListSmartFolders() {
+		stat := SmartFolderStat{SmartFolderId: folder.Id}
+		filter, err := folder.ItemFilter("")
+		if err != nil {
+			log.Printf("smart folder %d: %s", folder.Id, err)
+			continue
+		}
+		// `is:read` queries have no unread items by definition
+		if filter.IsRead == nil || !*filter.IsRead {
+			no := false
+			filter.IsRead = &no
+			stat.UnreadCount = int64(s.CountItems(filter))
+		}
+		result = append(result, stat)
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSmartFolders(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+	db.SyncSearch()
+
+	smart1 := db.CreateSmartFolder("titles", "title11 OR title21", nil, nil)
+	smart2 := db.CreateSmartFolder("starred", "is:starred", nil, &scope.folder1.Id)
+	if smart1 == nil || smart2 == nil {
+		t.Fatal("expected smart folders")
+	}
+
+	smart2.Title = "folder1 starred"
+	db.UpdateSmartFolder(*smart2)
+	have := db.ListSmartFolders()
+	want := []SmartFolder{*smart2, *smart1}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("invalid smart folder list\nwant: %#v\nhave: %#v", want, have)
+	}
+
+	cases := []struct {
+		smart *SmartFolder
+		extra string
+		want  []string
+	}{
+		{smart1, "", []string{"item111", "item112", "item113", "item211", "item212"}},
+		{smart1, "is:unread", []string{"item111"}},
+		// the saved query is grouped, i.e. `(title11 OR title21) title212`
+		{smart1, "title212", []string{"item212"}},
+		{smart2, "", []string{"item113"}},
+	}
+	for _, c := range cases {
+		filter, err := c.smart.ItemFilter(c.extra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have := getItemGuids(db.ListItems(filter, 10, false, false))
+		if !reflect.DeepEqual(have, c.want) {
+			t.Errorf("invalid items for %#v + %#v\nwant: %#v\nhave: %#v", c.smart.Query, c.extra, c.want, have)
+		}
+	}
+
+	haveStats := db.SmartFolderStats()
+	wantStats := []SmartFolderStat{
+		{SmartFolderId: smart2.Id, UnreadCount: 0},
+		{SmartFolderId: smart1.Id, UnreadCount: 1},
+	}
+	if !reflect.DeepEqual(haveStats, wantStats) {
+		t.Fatalf("invalid stats\nwant: %#v\nhave: %#v", wantStats, haveStats)
+	}
+
+	db.DeleteFolder(scope.folder1.Id)
+	if db.GetSmartFolder(smart2.Id) != nil {
+		t.Fatal("expected smart folder to be deleted along with its folder")
+	}
+}
+
+func TestSmartFolderExclusions(t *testing.T) {
+	db := testDB()
+	testItemsSetup(db)
+	db.SyncSearch()
+
+	smart := db.CreateSmartFolder("no title11", "-title11", nil, nil)
+	cases := []struct {
+		extra string
+		want  []string
+	}{
+		{"", []string{"item121", "item122", "item211", "item212", "item011", "item012", "item013"}},
+		// the saved exclusions still apply, i.e. `(-title11) title1`
+		{"title1", []string{"item121", "item122"}},
+	}
+	for _, c := range cases {
+		filter, err := smart.ItemFilter(c.extra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have := getItemGuids(db.ListItems(filter, 10, false, false))
+		if !reflect.DeepEqual(have, c.want) {
+			t.Errorf("invalid items for %#v + %#v\nwant: %#v\nhave: %#v", smart.Query, c.extra, c.want, have)
+		}
+	}
+}
@@ -23,3 +23,8 @@ func New(path string) (*Storage, error) {
 	}
 	return &Storage{db: db}, nil
 }
+
+// Close waits for the queries in progress & closes the database.
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
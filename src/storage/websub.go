@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// states of the WebSub subscriptions
+const (
+	WebSubPending    = "pending"
+	WebSubSubscribed = "subscribed"
+	WebSubDenied     = "denied"
+)
+
+// WebSub is the feed's push subscription to the hub it advertises.
+type WebSub struct {
+	FeedId int64
+	Hub    string
+	Topic  string
+	Secret string
+	State  string
+
+	LeaseExpires *time.Time
+	RequestedAt  *time.Time
+}
+
+// Active tells whether the hub is expected to push the feed's updates.
+func (w WebSub) Active(now time.Time) bool {
+	return w.State == WebSubSubscribed && w.LeaseExpires != nil && w.LeaseExpires.After(now)
+}
+
+// SetWebSubHub records the hub advertised by the feed.
+// The subscription starts over whenever the hub or the topic changes,
+// and is dropped once the feed stops advertising a hub.
+func (s *Storage) SetWebSubHub(feedId int64, hub, topic string) {
+	var err error
+	if hub == "" || topic == "" {
+		_, err = s.db.Exec(`delete from websub_subscriptions where feed_id = ?`, feedId)
+	} else {
+		_, err = s.db.Exec(`
+			insert into websub_subscriptions (feed_id, hub, topic)
+			values (?, ?, ?)
+			on conflict (feed_id) do update set
+				hub = excluded.hub,
+				topic = excluded.topic,
+				secret = '',
+				state = '',
+				lease_expires = null,
+				requested_at = null
+			where hub != excluded.hub or topic != excluded.topic`,
+			feedId, hub, topic,
+		)
+	}
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func (s *Storage) GetWebSub(feedId int64) *WebSub {
+	var w WebSub
+	err := s.db.QueryRow(`
+		select feed_id, hub, topic, secret, state, lease_expires, requested_at
+		from websub_subscriptions where feed_id = ?`,
+		feedId,
+	).Scan(&w.FeedId, &w.Hub, &w.Topic, &w.Secret, &w.State, &w.LeaseExpires, &w.RequestedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return &w
+}
+
+// ListWebSubsDue returns the subscriptions to (re)subscribe:
+// the new & denied ones & the ones whose lease expires before `renewBefore`.
+// The ones requested after `retryAfter` are still waiting for the hub.
+func (s *Storage) ListWebSubsDue(renewBefore, retryAfter time.Time) []WebSub {
+	result := make([]WebSub, 0)
+	rows, err := s.db.Query(`
+		select w.feed_id, w.hub, w.topic, w.secret, w.state, w.lease_expires, w.requested_at
+		from websub_subscriptions w
+		join feeds f on f.id = w.feed_id
+		where f.paused = 0
+		  and (w.state != ? or w.lease_expires is null or w.lease_expires < ?)
+		  and (w.requested_at is null or w.requested_at < ?)
+		order by w.feed_id`,
+		WebSubSubscribed, renewBefore.UTC(), retryAfter.UTC(),
+	)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var w WebSub
+		err = rows.Scan(&w.FeedId, &w.Hub, &w.Topic, &w.Secret, &w.State, &w.LeaseExpires, &w.RequestedAt)
+		if err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, w)
+	}
+	return result
+}
+
+// UpdateWebSubRequested marks the subscription as sent to the hub with the given secret.
+// The current state is kept until the hub verifies (or denies) the request.
+func (s *Storage) UpdateWebSubRequested(feedId int64, secret string) bool {
+	_, err := s.db.Exec(`
+		update websub_subscriptions
+		set secret = ?, requested_at = ?,
+			state = case when state = '' then ? else state end
+		where feed_id = ?`,
+		secret, time.Now().UTC(), WebSubPending, feedId,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+// ConfirmWebSub activates the subscription verified by the hub, provided that
+// it was requested after `requestedAfter`. The request is used up, so that
+// the same verification isn't accepted twice.
+func (s *Storage) ConfirmWebSub(feedId int64, requestedAfter, leaseExpires time.Time) bool {
+	res, err := s.db.Exec(`
+		update websub_subscriptions
+		set state = ?, lease_expires = ?, requested_at = null
+		where feed_id = ? and requested_at is not null and requested_at > ?`,
+		WebSubSubscribed, leaseExpires.UTC(), feedId, requestedAfter.UTC(),
+	)
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	num, err := res.RowsAffected()
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	return num > 0
+}
+
+func (s *Storage) UpdateWebSubState(feedId int64, state string, leaseExpires *time.Time) bool {
+	if leaseExpires != nil {
+		utc := leaseExpires.UTC()
+		leaseExpires = &utc
+	}
+	_, err := s.db.Exec(`
+		update websub_subscriptions set state = ?, lease_expires = ?
+		where feed_id = ?`,
+		state, leaseExpires, feedId,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebSub(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+
+	if db.GetWebSub(feed.Id) != nil {
+		t.Fatal("expected no subscription")
+	}
+	db.SetWebSubHub(feed.Id, "http://hub.example.com/", "http://example.com/feed.xml")
+
+	now := time.Now()
+	due := db.ListWebSubsDue(now.Add(time.Hour), now.Add(-time.Hour))
+	if len(due) != 1 || due[0].Hub != "http://hub.example.com/" || due[0].State != "" {
+		t.Fatalf("invalid due subscriptions: %#v", due)
+	}
+
+	db.UpdateWebSubRequested(feed.Id, "secret")
+	if len(db.ListWebSubsDue(now.Add(time.Hour), now.Add(-time.Hour))) != 0 {
+		t.Fatal("recently requested subscription must not be due")
+	}
+
+	lease := now.Add(time.Hour * 24 * 5)
+	db.UpdateWebSubState(feed.Id, WebSubSubscribed, &lease)
+	websub := db.GetWebSub(feed.Id)
+	if websub == nil || websub.Secret != "secret" || !websub.Active(now) {
+		t.Fatalf("invalid subscription: %#v", websub)
+	}
+	if len(db.ListWebSubsDue(now.Add(time.Hour*24*6), now.Add(time.Hour))) != 1 {
+		t.Fatal("expiring subscription must be due")
+	}
+
+	// same hub & topic keep the state
+	db.SetWebSubHub(feed.Id, "http://hub.example.com/", "http://example.com/feed.xml")
+	if websub := db.GetWebSub(feed.Id); websub.State != WebSubSubscribed {
+		t.Fatalf("subscription reset: %#v", websub)
+	}
+	// a new hub resets it
+	db.SetWebSubHub(feed.Id, "http://otherhub.example.com/", "http://example.com/feed.xml")
+	if websub := db.GetWebSub(feed.Id); websub.State != "" || websub.Secret != "" || websub.LeaseExpires != nil {
+		t.Fatalf("subscription not reset: %#v", websub)
+	}
+
+	db.SetWebSubHub(feed.Id, "", "")
+	if db.GetWebSub(feed.Id) != nil {
+		t.Fatal("expected subscription to be removed")
+	}
+}
+
+func TestFeedRefreshIntervalWebSub(t *testing.T) {
+	db := testDB()
+	db.UpdateSettings(map[string]interface{}{"refresh_rate": 30, "refresh_max_interval": 24 * 60})
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+	items := make([]Item, 0)
+	now := time.Now().UTC()
+	for i := 0; i < 10; i++ {
+		items = append(items, Item{GUID: string(rune('a' + i)), FeedId: feed.Id, Date: now.Add(-time.Hour * time.Duration(i))})
+	}
+	db.CreateItems(items)
+	if have := db.FeedRefreshInterval(*feed); have != time.Hour {
+		t.Fatalf("invalid interval: %s", have)
+	}
+
+	db.SetWebSubHub(feed.Id, "http://hub.example.com/", "http://example.com/feed.xml")
+	lease := now.Add(time.Hour)
+	db.UpdateWebSubState(feed.Id, WebSubSubscribed, &lease)
+	if have := db.FeedRefreshInterval(*feed); have != time.Hour*24 {
+		t.Fatalf("invalid interval: %s", have)
+	}
+}
@@ -1,52 +1,241 @@
 package worker
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/nkanaev/yarr/src/storage"
 )
 
+// Config tunes how the feeds are fetched.
+type Config struct {
+	UserAgent string
+	// http(s):// or socks5:// proxy url (if empty, the environment's proxy is used)
+	Proxy string
+
+	ConnectTimeout time.Duration
+	Timeout        time.Duration
+	KeepAlive      bool
+
+	// how many feeds are fetched at once, and how many of them from the same host
+	Workers     int
+	HostWorkers int
+
+	// how many times a failed request is retried (on network & server errors),
+	// waiting about `RetryDelay`, twice as long, etc. in between
+	Retries    int
+	RetryDelay time.Duration
+
+	// the url the hubs deliver the WebSub notifications to (no push, if empty)
+	PublicURL string
+}
+
+var DefaultConfig = Config{
+	UserAgent:      "Yarr/1.0",
+	ConnectTimeout: 10 * time.Second,
+	Timeout:        30 * time.Second,
+	Workers:        4,
+	HostWorkers:    2,
+	Retries:        2,
+	RetryDelay:     2 * time.Second,
+}
+
+var config = DefaultConfig
+
+// Configure replaces the fetcher settings. Meant to be called on startup.
+func Configure(c Config) error {
+	if c.Proxy != "" {
+		if _, err := ParseProxy(c.Proxy); err != nil {
+			return err
+		}
+	}
+	if c.PublicURL != "" {
+		if u, err := url.Parse(c.PublicURL); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid public url: %q", c.PublicURL)
+		}
+	}
+	if c.Workers < 1 {
+		c.Workers = 1
+	}
+	if c.HostWorkers < 1 || c.HostWorkers > c.Workers {
+		c.HostWorkers = c.Workers
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+	config = c
+	client = NewClient(c)
+	return nil
+}
+
+// ParseProxy checks the proxy url (one of http, https or socks5).
+func ParseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy host missing")
+	}
+	return u, nil
+}
+
 type Client struct {
-	httpClient *http.Client
-	userAgent  string
+	config Config
+
+	// http clients by proxy (feeds may use their own ones)
+	mu          sync.Mutex
+	httpClients map[string]*http.Client
+}
+
+func NewClient(c Config) *Client {
+	return &Client{config: c, httpClients: make(map[string]*http.Client)}
+}
+
+// fetchOptions are the request settings specific to a feed.
+type fetchOptions struct {
+	lastModified string
+	etag         string
+	credentials  *storage.FeedCredentials
+	userAgent    string
+	proxy        string
+}
+
+// feedOptions collects the feed's own request settings.
+func feedOptions(feed storage.Feed, db *storage.Storage) fetchOptions {
+	return fetchOptions{
+		credentials: db.GetFeedCredentials(feed.Id),
+		userAgent:   feed.UserAgent,
+		proxy:       feed.Proxy,
+	}
 }
 
-func (c *Client) get(url string) (*http.Response, error) {
-	return c.getConditional(url, "", "")
+func (c *Client) get(ctx context.Context, url string) (*http.Response, error) {
+	return c.fetch(ctx, url, fetchOptions{})
 }
 
-func (c *Client) getConditional(url, lastModified, etag string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (c *Client) fetch(ctx context.Context, url string, opts fetchOptions) (*http.Response, error) {
+	httpClient, err := c.httpClient(opts.proxy)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", c.userAgent)
-	if lastModified != "" {
-		req.Header.Set("If-Modified-Since", lastModified)
+	req.Header.Set("User-Agent", c.config.UserAgent)
+	if opts.userAgent != "" {
+		req.Header.Set("User-Agent", opts.userAgent)
+	}
+	if opts.lastModified != "" {
+		req.Header.Set("If-Modified-Since", opts.lastModified)
+	}
+	if opts.etag != "" {
+		req.Header.Set("If-None-Match", opts.etag)
+	}
+	if opts.credentials != nil {
+		setCredentials(req, *opts.credentials)
+		req = req.WithContext(context.WithValue(ctx, credentialsKey{}, opts.credentials))
 	}
-	if etag != "" {
-		req.Header.Set("If-None-Match", etag)
+	return httpClient.Do(req)
+}
+
+func (c *Client) postForm(ctx context.Context, url string, form url.Values) (*http.Response, error) {
+	httpClient, err := c.httpClient("")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
 	}
-	return c.httpClient.Do(req)
+	req.Header.Set("User-Agent", c.config.UserAgent)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return httpClient.Do(req)
 }
 
-var client *Client
+func (c *Client) httpClient(proxy string) (*http.Client, error) {
+	if proxy == "" {
+		proxy = c.config.Proxy
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if httpClient, ok := c.httpClients[proxy]; ok {
+		return httpClient, nil
+	}
 
-func init() {
 	transport := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
-			Timeout: 10 * time.Second,
+			Timeout: c.config.ConnectTimeout,
 		}).DialContext,
-		DisableKeepAlives:   true,
-		TLSHandshakeTimeout: time.Second * 10,
+		DisableKeepAlives:   !c.config.KeepAlive,
+		TLSHandshakeTimeout: c.config.ConnectTimeout,
+	}
+	if proxy != "" {
+		proxyURL, err := ParseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
 	}
 	httpClient := &http.Client{
-		Timeout:   time.Second * 30,
-		Transport: transport,
+		Timeout:       c.config.Timeout,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	}
+	c.httpClients[proxy] = httpClient
+	return httpClient, nil
+}
+
+// setCredentials authorizes the request to a private feed.
+// Custom headers go last, so that they can override the rest.
+func setCredentials(req *http.Request, credentials storage.FeedCredentials) {
+	if credentials.Username != "" || credentials.Password != "" {
+		req.SetBasicAuth(credentials.Username, credentials.Password)
+	}
+	if credentials.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+credentials.Token)
 	}
-	client = &Client{
-		httpClient: httpClient,
-		userAgent:  "Yarr/1.0",
+	for name, value := range credentials.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	for name, value := range credentials.Headers {
+		req.Header.Set(name, value)
 	}
 }
+
+// credentialsKey holds the feed credentials the request was sent with.
+type credentialsKey struct{}
+
+// checkRedirect keeps the feed's credentials from following
+// the redirects to other hosts (the custom headers included).
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	credentials, ok := req.Context().Value(credentialsKey{}).(*storage.FeedCredentials)
+	if ok && !sameHost(req.URL.String(), via[0].URL.String()) {
+		req.Header.Del("Authorization")
+		req.Header.Del("Cookie")
+		for name := range credentials.Headers {
+			req.Header.Del(name)
+		}
+	}
+	return nil
+}
+
+var client = NewClient(DefaultConfig)
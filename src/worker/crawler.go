@@ -2,14 +2,17 @@ package worker
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"log"
+	"math/rand"
 	"mime"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/nkanaev/yarr/src/content/scraper"
 	"github.com/nkanaev/yarr/src/parser"
@@ -28,10 +31,10 @@ type DiscoverResult struct {
 	Sources  []FeedSource
 }
 
-func DiscoverFeed(candidateUrl string) (*DiscoverResult, error) {
+func DiscoverFeed(ctx context.Context, candidateUrl string) (*DiscoverResult, error) {
 	result := &DiscoverResult{}
 	// Query URL
-	res, err := client.get(candidateUrl)
+	res, err := client.get(ctx, candidateUrl)
 	if err != nil {
 		return nil, err
 	}
@@ -74,69 +77,28 @@ func DiscoverFeed(candidateUrl string) (*DiscoverResult, error) {
 		if sources[0].Url == candidateUrl {
 			return nil, errors.New("Recursion!")
 		}
-		return DiscoverFeed(sources[0].Url)
+		return DiscoverFeed(ctx, sources[0].Url)
 	}
 
 	result.Sources = sources
 	return result, nil
 }
 
-var emptyIcon = make([]byte, 0)
-var imageTypes = map[string]bool{
-	"image/x-icon": true,
-	"image/png":    true,
-	"image/jpeg":   true,
-	"image/gif":    true,
-}
-
-func findFavicon(siteUrl, feedUrl string) (*[]byte, error) {
-	urls := make([]string, 0)
-
-	favicon := func(link string) string {
-		u, err := url.Parse(link)
-		if err != nil {
-			return ""
-		}
-		return fmt.Sprintf("%s://%s/favicon.ico", u.Scheme, u.Host)
-	}
-
-	if siteUrl != "" {
-		if res, err := client.get(siteUrl); err == nil {
-			defer res.Body.Close()
-			if body, err := ioutil.ReadAll(res.Body); err == nil {
-				urls = append(urls, scraper.FindIcons(string(body), siteUrl)...)
-				if c := favicon(siteUrl); c != "" {
-					urls = append(urls, c)
-				}
-			}
-		}
+// ScrapePage makes up the feed from the page without one, using the selectors.
+func ScrapePage(ctx context.Context, pageUrl string, selectors scraper.Selectors) (*DiscoverResult, error) {
+	res, err := client.get(ctx, pageUrl)
+	if err != nil {
+		return nil, err
 	}
-
-	if c := favicon(feedUrl); c != "" {
-		urls = append(urls, c)
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code %d", res.StatusCode)
 	}
-
-	for _, u := range urls {
-		res, err := client.get(u)
-		if err != nil {
-			continue
-		}
-		defer res.Body.Close()
-		if res.StatusCode != 200 {
-			continue
-		}
-
-		content, err := ioutil.ReadAll(res.Body)
-		if err != nil {
-			continue
-		}
-
-		ctype := http.DetectContentType(content)
-		if imageTypes[ctype] {
-			return &content, nil
-		}
+	feed, err := parser.ParseHTML(res.Body, pageUrl, getCharset(res), selectors)
+	if err != nil {
+		return nil, err
 	}
-	return &emptyIcon, nil
+	return &DiscoverResult{Feed: feed, FeedLink: pageUrl}, nil
 }
 
 func ConvertItems(items []parser.Item, feed storage.Feed) []storage.Item {
@@ -156,55 +118,182 @@ func ConvertItems(items []parser.Item, feed storage.Feed) []storage.Item {
 			FeedId:   feed.Id,
 			Title:    item.Title,
 			Link:     item.URL,
+			Author:   item.Author,
 			Content:  item.Content,
 			Date:     item.Date,
-			Status:   storage.UNREAD,
 			ImageURL: imageURL,
 			AudioURL: audioURL,
+
+			Categories: item.Categories,
 		}
 	}
 	return result
 }
 
-func listItems(f storage.Feed, db *storage.Storage) ([]storage.Item, error) {
-	lmod := ""
-	etag := ""
+// errNotAllowed tells that the feed wasn't fetched, as its server asked
+// to wait until later (see `storage.SetHTTPNextAllowed`).
+var errNotAllowed = errors.New("not allowed to fetch until later")
+
+// listItems fetches the feed's items. If the feed has permanently moved
+// (and is served at the new url), its link (or id, if merged with another feed)
+// is updated in place.
+func listItems(ctx context.Context, f *storage.Feed, db *storage.Storage) ([]storage.Item, error) {
+	now := time.Now()
+	opts := feedOptions(*f, db)
 	if state := db.GetHTTPState(f.Id); state != nil {
-		lmod = state.LastModified
-		etag = state.Etag
+		if state.NextAllowed != nil && state.NextAllowed.After(now) {
+			return nil, errNotAllowed
+		}
+		opts.lastModified = state.LastModified
+		opts.etag = state.Etag
+	}
+
+	// don't let the server put the feed off for longer than the refresh interval allows
+	_, maxInterval := db.RefreshBounds()
+	setNextAllowed := func(until time.Time) {
+		if !until.After(now) {
+			return
+		}
+		if limit := now.Add(maxInterval); until.After(limit) {
+			until = limit
+		}
+		db.SetHTTPNextAllowed(f.Id, until)
 	}
 
-	res, err := client.getConditional(f.FeedLink, lmod, etag)
+	res, err := fetchRetrying(ctx, f.FeedLink, opts)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 
 	switch {
+	case res.StatusCode == http.StatusGone:
+		db.UpdateFeedPaused(f.Id, true, "the feed is gone (status code 410)")
+		return nil, fmt.Errorf("feed gone")
 	case res.StatusCode < 200 || res.StatusCode > 399:
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+			setNextAllowed(retryAfter(res, now))
+		}
 		if res.StatusCode == 404 {
 			return nil, fmt.Errorf("feed not found")
 		}
 		return nil, fmt.Errorf("status code %d", res.StatusCode)
 	case res.StatusCode == http.StatusNotModified:
+		setNextAllowed(cacheUntil(res, now))
 		return nil, nil
 	}
 
-	feed, err := parser.ParseAndFix(res.Body, f.FeedLink, getCharset(res))
+	feedLink := f.FeedLink
+	movedLink := permanentRedirect(res)
+	if movedLink != "" {
+		feedLink = movedLink
+	}
+
+	var feed *parser.Feed
+	if f.Scraper != nil {
+		feed, err = parser.ParseHTML(res.Body, feedLink, getCharset(res), *f.Scraper)
+	} else {
+		feed, err = parser.ParseAndFix(res.Body, feedLink, getCharset(res))
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	lmod = res.Header.Get("Last-Modified")
-	etag = res.Header.Get("Etag")
+	// the move is only trusted once the new url turns out to serve the feed
+	// (rather than e.g. a login page or a parked domain)
+	if movedLink != "" {
+		if id, ok := db.UpdateFeedLink(f.Id, movedLink); ok {
+			log.Printf("Feed %s moved to %s", f.FeedLink, movedLink)
+			f.Id = id
+			f.FeedLink = movedLink
+		}
+	}
+
+	lmod := res.Header.Get("Last-Modified")
+	etag := res.Header.Get("Etag")
 	if lmod != "" || etag != "" {
 		db.SetHTTPState(f.Id, lmod, etag)
 	}
-	return ConvertItems(feed.Items, f), nil
+	setNextAllowed(latest(cacheUntil(res, now), feedUntil(feed, now)))
+	SetFeedHub(*f, feed, db)
+	return ConvertItems(feed.Items, *f), nil
+}
+
+// fetchRetrying fetches the url, retrying the transient failures
+// (network & server errors) up to `Config.Retries` times with a jittered
+// exponential backoff. The servers asking to come back later (429 & 503)
+// aren't retried, their wish is respected by the scheduler instead.
+func fetchRetrying(ctx context.Context, link string, opts fetchOptions) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := client.fetch(ctx, link, opts)
+		if attempt >= config.Retries || !transientFailure(res, err) || ctx.Err() != nil {
+			return res, err
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+		select {
+		case <-time.After(retryDelay(attempt)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func transientFailure(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryDelay doubles the delay with every attempt, randomizing it by ±50%
+// so that the feeds failing together don't retry together.
+func retryDelay(attempt int) time.Duration {
+	delay := config.RetryDelay << attempt
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)))
+}
+
+// permanentRedirect returns the url the response was permanently redirected to
+// (the url after the last one of the leading 301/308 redirects), if any.
+func permanentRedirect(res *http.Response) string {
+	requests := make([]*http.Request, 0)
+	for req := res.Request; req != nil; {
+		requests = append([]*http.Request{req}, requests...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	link := ""
+	for _, req := range requests[1:] {
+		status := req.Response.StatusCode
+		if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+			break
+		}
+		link = req.URL.String()
+	}
+	return link
+}
+
+func sameHost(link1, link2 string) bool {
+	u1, err1 := url.Parse(link1)
+	u2, err2 := url.Parse(link2)
+	return err1 == nil && err2 == nil && strings.EqualFold(u1.Host, u2.Host)
 }
 
 func getCharset(res *http.Response) string {
-	contentType := res.Header.Get("Content-Type")
+	return contentCharset(res.Header.Get("Content-Type"))
+}
+
+func contentCharset(contentType string) string {
 	if _, params, err := mime.ParseMediaType(contentType); err == nil {
 		if cs, ok := params["charset"]; ok {
 			if e, _ := charset.Lookup(cs); e != nil {
@@ -215,8 +304,8 @@ func getCharset(res *http.Response) string {
 	return ""
 }
 
-func GetBody(url string) (string, error) {
-	res, err := client.get(url)
+func GetBody(ctx context.Context, url string) (string, error) {
+	res, err := client.get(ctx, url)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,57 @@
+package worker
+
+import "sync"
+
+// Event is a notification about a change of the app's state
+// (refresh progress, new items, counters, settings, ...).
+type Event struct {
+	Name string
+	Data interface{}
+}
+
+// how many events a subscriber may lag behind before missing the new ones
+const subscriberBuffer = 64
+
+// Broker fans the published events out to the subscribers.
+// Slow subscribers miss events rather than holding up the publisher.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[chan Event]bool)}
+}
+
+func (b *Broker) Subscribe() chan Event {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = true
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *Broker) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+}
+
+// Listening reports whether anyone is subscribed,
+// so that costly events can be skipped otherwise.
+func (b *Broker) Listening() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers) > 0
+}
+
+func (b *Broker) Publish(name string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- Event{Name: name, Data: data}:
+		default:
+		}
+	}
+}
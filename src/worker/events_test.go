@@ -0,0 +1,29 @@
+package worker
+
+import "testing"
+
+func TestBroker(t *testing.T) {
+	broker := NewBroker()
+	if broker.Listening() {
+		t.Fatal("expected no subscribers")
+	}
+	ch1 := broker.Subscribe()
+	ch2 := broker.Subscribe()
+	broker.Publish("test", 1)
+	for _, ch := range []chan Event{ch1, ch2} {
+		if event := <-ch; event.Name != "test" || event.Data != 1 {
+			t.Fatalf("invalid event: %#v", event)
+		}
+	}
+
+	broker.Unsubscribe(ch2)
+	for i := 0; i < subscriberBuffer+10; i++ {
+		broker.Publish("test", i)
+	}
+	if len(ch1) != subscriberBuffer {
+		t.Fatalf("expected a full buffer, have: %d", len(ch1))
+	}
+	if len(ch2) != 0 {
+		t.Fatal("unsubscribed channel must not receive events")
+	}
+}
@@ -0,0 +1,291 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/nkanaev/yarr/src/content/scraper"
+	"github.com/nkanaev/yarr/src/parser"
+)
+
+const (
+	// the icons larger than that are scaled down
+	iconSize = 64
+	// the icons heavier than that are ignored
+	maxIconBytes = 1 << 20
+	// how many of the links found are tried
+	maxIconCandidates = 10
+	// the icons with more pixels than that aren't decoded (a small file may declare
+	// huge dimensions, taking lots of memory to decode)
+	maxIconPixels = 2048 * 2048
+)
+
+var emptyIcon = make([]byte, 0)
+
+type icon struct {
+	data  []byte
+	ctype string
+	// the larger side in pixels (0 if unknown or if it's a vector image)
+	size   int
+	vector bool
+}
+
+// score ranks the icons: the smallest of the ones big enough come first,
+// then the vector ones & then the rest, the bigger the better.
+func (ic icon) score() int {
+	switch {
+	case ic.size >= iconSize:
+		return 2<<20 - ic.size
+	case ic.vector:
+		return 1 << 20
+	}
+	return ic.size
+}
+
+// findFavicon looks for the icon of the feed. The candidates are the icons
+// listed in the feed itself, in the website's html & web app manifest,
+// and the `/favicon.ico`s. The one of the best size is picked.
+// The feed's credentials (if any) are only sent to the feed's host.
+func findFavicon(ctx context.Context, siteUrl, feedUrl string, opts fetchOptions) (*[]byte, error) {
+	urls := make([]string, 0)
+
+	get := func(link string) (*http.Response, error) {
+		linkOpts := opts
+		if !sameHost(link, feedUrl) {
+			linkOpts.credentials = nil
+		}
+		res, err := client.fetch(ctx, link, linkOpts)
+		if err == nil && res.StatusCode != 200 {
+			res.Body.Close()
+			err = fmt.Errorf("status code %d", res.StatusCode)
+		}
+		return res, err
+	}
+	read := func(link string) []byte {
+		res, err := get(link)
+		if err != nil {
+			return nil
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(res.Body, maxIconBytes+1))
+		if err != nil || len(body) > maxIconBytes {
+			return nil
+		}
+		return body
+	}
+
+	favicon := func(link string) string {
+		u, err := url.Parse(link)
+		if err != nil || u.Host == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s://%s/favicon.ico", u.Scheme, u.Host)
+	}
+
+	if res, err := get(feedUrl); err == nil {
+		if feed, err := parser.ParseAndFix(res.Body, feedUrl, getCharset(res)); err == nil {
+			urls = append(urls, feed.IconURL, feed.LogoURL)
+			if siteUrl == "" {
+				siteUrl = feed.SiteURL
+			}
+		}
+		res.Body.Close()
+	}
+
+	if siteUrl != "" {
+		if body := read(siteUrl); body != nil {
+			urls = append(urls, scraper.FindIcons(string(body), siteUrl)...)
+			if manifest := scraper.FindManifest(string(body), siteUrl); manifest != "" {
+				if data := read(manifest); data != nil {
+					urls = append(urls, scraper.ManifestIcons(data, manifest)...)
+				}
+			}
+		}
+		urls = append(urls, favicon(siteUrl))
+	}
+	urls = append(urls, favicon(feedUrl))
+
+	var best *icon
+	tried := make(map[string]bool)
+	for _, u := range urls {
+		if u == "" || tried[u] {
+			continue
+		}
+		if len(tried) == maxIconCandidates {
+			break
+		}
+		tried[u] = true
+
+		content := read(u)
+		if content == nil {
+			continue
+		}
+		if ic := decodeIcon(content); ic != nil && (best == nil || ic.score() > best.score()) {
+			best = ic
+		}
+	}
+	// the search has been cut short
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if best == nil {
+		return &emptyIcon, nil
+	}
+	content := resizeIcon(*best)
+	return &content, nil
+}
+
+// IconType detects the icon's content type.
+func IconType(data []byte) string {
+	if isSVG(data) {
+		return "image/svg+xml"
+	}
+	return http.DetectContentType(data)
+}
+
+func decodeIcon(data []byte) *icon {
+	ic := &icon{data: data, ctype: IconType(data)}
+	switch ic.ctype {
+	case "image/png", "image/jpeg", "image/gif":
+		config, ok := iconConfig(data)
+		if !ok {
+			return nil
+		}
+		ic.size = config.Width
+		if config.Height > ic.size {
+			ic.size = config.Height
+		}
+	case "image/x-icon":
+		ic.size = icoSize(data)
+	case "image/webp":
+	case "image/svg+xml":
+		ic.vector = true
+	default:
+		return nil
+	}
+	return ic
+}
+
+// iconConfig reads the raster image's dimensions, refusing the too large ones.
+func iconConfig(data []byte) (image.Config, bool) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return config, false
+	}
+	return config, config.Width*config.Height <= maxIconPixels
+}
+
+// isSVG tells whether the document's root element is `svg`.
+func isSVG(data []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			return t.Name.Local == "svg"
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return false
+			}
+		}
+	}
+}
+
+// icoSize returns the size of the largest image in the .ico file.
+// See: https://en.wikipedia.org/wiki/ICO_(file_format)
+func icoSize(data []byte) int {
+	if len(data) < 6 {
+		return 0
+	}
+	size := 0
+	count := int(binary.LittleEndian.Uint16(data[4:6]))
+	for i := 0; i < count && 6+i*16+2 <= len(data); i++ {
+		entry := data[6+i*16:]
+		// 0 means 256 pixels
+		width, height := int(entry[0]), int(entry[1])
+		if width == 0 {
+			width = 256
+		}
+		if height == 0 {
+			height = 256
+		}
+		if width > size {
+			size = width
+		}
+		if height > size {
+			size = height
+		}
+	}
+	return size
+}
+
+// resizeIcon scales the raster icons larger than `iconSize` down to it
+// (keeping the aspect ratio) & returns them as png.
+func resizeIcon(ic icon) []byte {
+	if ic.size <= iconSize || (ic.ctype != "image/png" && ic.ctype != "image/jpeg" && ic.ctype != "image/gif") {
+		return ic.data
+	}
+	if _, ok := iconConfig(ic.data); !ok {
+		return ic.data
+	}
+	img, _, err := image.Decode(bytes.NewReader(ic.data))
+	if err != nil {
+		return ic.data
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scaleDown(img, iconSize)); err != nil {
+		return ic.data
+	}
+	return buf.Bytes()
+}
+
+// scaleDown fits the image into size x size pixels, averaging the pixels
+// of the source area each pixel of the result covers.
+func scaleDown(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := size, size
+	if w > h {
+		dh = h * size / w
+	} else if h > w {
+		dw = w * size / h
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := bounds.Min.Y+y*h/dh, bounds.Min.Y+(y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := bounds.Min.X+x*w/dw, bounds.Min.X+(x+1)*w/dw
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func testPNG(width, height int) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, width, height)))
+	return buf.Bytes()
+}
+
+func TestFindFavicon(t *testing.T) {
+	svg := []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 16"></svg>`)
+	files := map[string][]byte{
+		"/feed.xml": []byte(`<?xml version="1.0"?>
+			<feed xmlns="http://www.w3.org/2005/Atom">
+				<icon>/feed-icon.png</icon>
+			</feed>`),
+		"/": []byte(`<html><head>
+			<link rel="icon" href="/icon.svg">
+			<link rel="apple-touch-icon" href="/apple-touch-icon.png">
+			<link rel="manifest" href="/site.webmanifest">
+		</head></html>`),
+		"/site.webmanifest":           []byte(`{"icons": [{"src": "/android-chrome-512x512.png"}]}`),
+		"/feed-icon.png":              testPNG(16, 16),
+		"/icon.svg":                   svg,
+		"/apple-touch-icon.png":       testPNG(180, 180),
+		"/android-chrome-512x512.png": testPNG(512, 256),
+		"/favicon.ico":                {0, 0, 1, 0, 1, 0, 32, 32, 0, 0, 1, 0, 32, 0, 0, 0, 0, 0, 22, 0, 0, 0},
+	}
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requested[r.URL.Path] = true
+		if data, ok := files[r.URL.Path]; ok {
+			w.Write(data)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	icon, err := findFavicon(context.Background(), server.URL+"/", server.URL+"/feed.xml", fetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	for _, path := range []string{"/feed-icon.png", "/icon.svg", "/apple-touch-icon.png", "/android-chrome-512x512.png", "/favicon.ico"} {
+		if !requested[path] {
+			t.Errorf("expected %s to be checked", path)
+		}
+	}
+	mu.Unlock()
+	// the smallest one big enough, scaled down
+	config, _, err := image.DecodeConfig(bytes.NewReader(*icon))
+	if err != nil || config.Width != iconSize || config.Height != iconSize {
+		t.Fatalf("invalid icon: %#v %v", config, err)
+	}
+
+	// the vector one is preferred to the small ones
+	mu.Lock()
+	delete(files, "/apple-touch-icon.png")
+	delete(files, "/site.webmanifest")
+	mu.Unlock()
+	if icon, _ = findFavicon(context.Background(), server.URL+"/", server.URL+"/feed.xml", fetchOptions{}); !bytes.Equal(*icon, svg) {
+		t.Fatalf("expected svg icon, have: %q", *icon)
+	}
+	if IconType(*icon) != "image/svg+xml" {
+		t.Fatalf("invalid icon type: %s", IconType(*icon))
+	}
+
+	// the biggest of the small ones
+	mu.Lock()
+	delete(files, "/icon.svg")
+	mu.Unlock()
+	if icon, _ = findFavicon(context.Background(), server.URL+"/", server.URL+"/feed.xml", fetchOptions{}); !bytes.Equal(*icon, files["/favicon.ico"]) {
+		t.Fatalf("expected ico icon, have: %q", *icon)
+	}
+}
+
+func TestScaleDown(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 100; y++ {
+			img.Pix[img.PixOffset(x, y)+3] = 255
+		}
+	}
+	scaled := scaleDown(img, 64).(*image.NRGBA)
+	if scaled.Bounds() != image.Rect(0, 0, 64, 32) {
+		t.Fatalf("invalid bounds: %s", scaled.Bounds())
+	}
+	if a := scaled.NRGBAAt(0, 0).A; a != 255 {
+		t.Errorf("expected opaque pixel on the left, have alpha %d", a)
+	}
+	if a := scaled.NRGBAAt(63, 0).A; a != 0 {
+		t.Errorf("expected transparent pixel on the right, have alpha %d", a)
+	}
+}
+
+func TestDecodeIconTooLarge(t *testing.T) {
+	// a tiny png declaring huge dimensions in its header
+	data := testPNG(1, 1)
+	binary.BigEndian.PutUint32(data[16:20], 100000)
+	binary.BigEndian.PutUint32(data[20:24], 100000)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+
+	if ic := decodeIcon(data); ic != nil {
+		t.Fatalf("expected the icon to be refused, have size %d", ic.size)
+	}
+	if resized := resizeIcon(icon{data: data, ctype: "image/png", size: 100000}); !bytes.Equal(resized, data) {
+		t.Fatal("expected the icon not to be decoded")
+	}
+	if ic := decodeIcon(testPNG(128, 128)); ic == nil || ic.size != 128 {
+		t.Fatalf("expected the icon to be accepted, have: %#v", ic)
+	}
+}
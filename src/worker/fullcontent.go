@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"sort"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+	"github.com/nkanaev/yarr/src/content/readability"
+	"github.com/nkanaev/yarr/src/content/sanitizer"
+	"github.com/nkanaev/yarr/src/storage"
+	"golang.org/x/net/html/charset"
+)
+
+// maximum number of articles fetched per feed refresh (the newest items go first)
+const fullContentLimit = 20
+
+// fetchFullContent replaces the content of the feed's new items with
+// the article extracted from their page, keeping the original as the summary.
+// The items whose article couldn't be fetched are left as they are.
+func fetchFullContent(ctx context.Context, feed storage.Feed, items []storage.Item, db *storage.Storage) []storage.Item {
+	guids := make([]string, len(items))
+	for i, item := range items {
+		guids[i] = item.GUID
+	}
+	isNew := db.NewItemGUIDs(feed.Id, guids)
+
+	candidates := make([]int, 0)
+	for i, item := range items {
+		if isNew[item.GUID] && item.Link != "" {
+			candidates = append(candidates, i)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return items[candidates[i]].Date.After(items[candidates[j]].Date)
+	})
+	if len(candidates) > fullContentLimit {
+		candidates = candidates[:fullContentLimit]
+	}
+
+	opts := feedOptions(feed, db)
+	for _, i := range candidates {
+		item := &items[i]
+		link := item.Link
+		if !htmlutil.IsAPossibleLink(link) {
+			base := feed.Link
+			if base == "" {
+				base = feed.FeedLink
+			}
+			link = htmlutil.AbsoluteUrl(link, base)
+		}
+		content, err := fetchArticle(ctx, link, feed.FeedLink, opts)
+		if err != nil {
+			log.Printf("Failed to fetch full content of %s: %s", item.Link, err)
+			continue
+		}
+		summary := item.Content
+		item.Summary = &summary
+		item.Content = content
+	}
+	return items
+}
+
+// fetchArticle extracts the (sanitized) article from the page.
+// The feed's credentials are only sent to the feed's host.
+func fetchArticle(ctx context.Context, link, feedLink string, opts fetchOptions) (string, error) {
+	if !sameHost(link, feedLink) {
+		opts.credentials = nil
+	}
+	res, err := client.fetch(ctx, link, opts)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("status code %d", res.StatusCode)
+	}
+	contentType := res.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType != "text/html" {
+		return "", fmt.Errorf("not an html page: %s", mediaType)
+	}
+	body, err := charset.NewReader(res.Body, contentType)
+	if err != nil {
+		return "", err
+	}
+	content, err := readability.ExtractContent(body)
+	if err != nil {
+		return "", err
+	}
+	return sanitizer.Sanitize(link, content), nil
+}
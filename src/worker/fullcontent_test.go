@@ -0,0 +1,98 @@
+package worker
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+func TestRefreshFullContent(t *testing.T) {
+	article := `<p>` + strings.Repeat("The whole story, with every single detail of it. ", 20) + `</p>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			w.Write([]byte(`<?xml version="1.0"?>
+				<rss version="2.0"><channel>
+					<item><guid>1</guid><link>/story</link><description>teaser</description></item>
+					<item><guid>2</guid><link>/missing</link><description>other teaser</description></item>
+				</channel></rss>`))
+		case "/story":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><body>
+				<nav><a href="/">home</a></nav>
+				<article>` + article + `<script>alert(1)</script></article>
+			</body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(":memory:")
+	feed := db.CreateFeed("", "", server.URL, server.URL+"/feed.xml", nil)
+	db.UpdateFeedFullContent(feed.Id, true)
+
+	results, _ := NewWorker(db).RefreshFeedsNow([]storage.Feed{*db.GetFeed(feed.Id)})
+	if len(results) != 1 || results[0].NewItems != 2 {
+		t.Fatalf("invalid results: %#v", results)
+	}
+	items := db.ListItems(storage.ItemFilter{FeedID: &feed.Id}, 10, false, true)
+	byLink := make(map[string]storage.Item)
+	for _, item := range items {
+		byLink[item.Link] = *db.GetItem(item.Id)
+	}
+
+	story := byLink["/story"]
+	if !strings.Contains(story.Content, "every single detail") || strings.Contains(story.Content, "script") {
+		t.Errorf("expected the sanitized article, have: %q", story.Content)
+	}
+	if story.Summary == nil || *story.Summary != "teaser" {
+		t.Errorf("expected the summary to be kept, have: %#v", story.Summary)
+	}
+	if missing := byLink["/missing"]; missing.Content != "other teaser" || missing.Summary != nil {
+		t.Errorf("expected the feed's content, have: %#v", missing)
+	}
+}
+
+func TestIngestFullContent(t *testing.T) {
+	article := `<p>` + strings.Repeat("The whole story, with every single detail of it. ", 20) + `</p>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><body><article>` + article + `</article></body></html>`))
+	}))
+	defer server.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(":memory:")
+	feed := db.CreateFeed("", "", server.URL, server.URL+"/feed.xml", nil)
+	db.UpdateFeedFullContent(feed.Id, true)
+
+	w := NewWorker(db)
+	pushed := `<?xml version="1.0"?>
+		<rss version="2.0"><channel>
+			<item><guid>1</guid><link>/story</link><description>teaser</description></item>
+		</channel></rss>`
+	if err := w.Ingest(*db.GetFeed(feed.Id), strings.NewReader(pushed), "application/rss+xml"); err != nil {
+		t.Fatal(err)
+	}
+	// the items are stored in the background
+	w.running.Wait()
+
+	items := db.ListItems(storage.ItemFilter{FeedID: &feed.Id}, 10, false, true)
+	if len(items) != 1 {
+		t.Fatalf("expected the pushed item, have: %#v", items)
+	}
+	item := db.GetItem(items[0].Id)
+	if !strings.Contains(item.Content, "every single detail") || item.Summary == nil || *item.Summary != "teaser" {
+		t.Fatalf("expected the full content, have: %#v", item)
+	}
+}
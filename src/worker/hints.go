@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nkanaev/yarr/src/parser"
+)
+
+// cacheUntil returns the time the response stays fresh until,
+// as told by `Cache-Control: max-age` or `Expires` (zero if none).
+func cacheUntil(res *http.Response, now time.Time) time.Time {
+	if cc := res.Header.Get("Cache-Control"); cc != "" {
+		for _, directive := range strings.Split(cc, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if directive == "no-cache" || directive == "no-store" {
+				return time.Time{}
+			}
+			if strings.HasPrefix(directive, "max-age=") {
+				seconds, err := strconv.Atoi(strings.Trim(directive[len("max-age="):], `"`))
+				if err != nil || seconds <= 0 {
+					return time.Time{}
+				}
+				return now.Add(time.Second * time.Duration(seconds))
+			}
+		}
+	}
+	if expires := res.Header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil && t.After(now) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// retryAfter parses the `Retry-After` header, given either in seconds or as a date.
+func retryAfter(res *http.Response, now time.Time) time.Time {
+	value := strings.TrimSpace(res.Header.Get("Retry-After"))
+	if value == "" {
+		return time.Time{}
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return time.Time{}
+		}
+		return now.Add(time.Second * time.Duration(seconds))
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t
+	}
+	return time.Time{}
+}
+
+// feedUntil returns the earliest time the feed wants to be refreshed at,
+// according to its ttl and skip hours/days (zero if the feed has no hints).
+func feedUntil(feed *parser.Feed, now time.Time) time.Time {
+	if feed.TTL == 0 && len(feed.SkipHours) == 0 && len(feed.SkipDays) == 0 {
+		return time.Time{}
+	}
+	skipHours := make(map[int]bool)
+	for _, hour := range feed.SkipHours {
+		skipHours[hour] = true
+	}
+	skipDays := make(map[time.Weekday]bool)
+	for _, day := range feed.SkipDays {
+		skipDays[day] = true
+	}
+
+	until := now.Add(feed.TTL).UTC()
+	// move out of the skipped hours, giving up after a week of them
+	for i := 0; i < 7*24; i++ {
+		if !skipHours[until.Hour()] && !skipDays[until.Weekday()] {
+			break
+		}
+		until = until.Truncate(time.Hour).Add(time.Hour)
+	}
+	if !until.After(now) {
+		return time.Time{}
+	}
+	return until
+}
+
+// latest returns the latest of the given times.
+func latest(times ...time.Time) time.Time {
+	result := time.Time{}
+	for _, t := range times {
+		if t.After(result) {
+			result = t
+		}
+	}
+	return result
+}
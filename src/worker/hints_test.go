@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nkanaev/yarr/src/parser"
+)
+
+func TestCacheUntil(t *testing.T) {
+	now := time.Date(2021, time.May, 1, 12, 0, 0, 0, time.UTC)
+	testcases := []struct {
+		header http.Header
+		want   time.Time
+	}{
+		{http.Header{}, time.Time{}},
+		{http.Header{"Cache-Control": {"public, max-age=600"}}, now.Add(10 * time.Minute)},
+		{http.Header{"Cache-Control": {"no-cache, max-age=600"}}, time.Time{}},
+		{http.Header{"Expires": {"Sat, 01 May 2021 14:00:00 GMT"}}, now.Add(2 * time.Hour)},
+		{http.Header{"Expires": {"Sat, 01 May 2021 10:00:00 GMT"}}, time.Time{}},
+		{http.Header{"Expires": {"0"}}, time.Time{}},
+	}
+	for _, testcase := range testcases {
+		have := cacheUntil(&http.Response{Header: testcase.header}, now)
+		if !have.Equal(testcase.want) {
+			t.Errorf("%v\nwant: %s\nhave: %s", testcase.header, testcase.want, have)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2021, time.May, 1, 12, 0, 0, 0, time.UTC)
+	testcases := map[string]time.Time{
+		"":                              time.Time{},
+		"120":                           now.Add(2 * time.Minute),
+		"Sat, 01 May 2021 13:00:00 GMT": now.Add(time.Hour),
+		"soon":                          time.Time{},
+	}
+	for value, want := range testcases {
+		res := &http.Response{Header: http.Header{"Retry-After": {value}}}
+		if have := retryAfter(res, now); !have.Equal(want) {
+			t.Errorf("%#v\nwant: %s\nhave: %s", value, want, have)
+		}
+	}
+}
+
+func TestFeedUntil(t *testing.T) {
+	// saturday
+	now := time.Date(2021, time.May, 1, 12, 30, 0, 0, time.UTC)
+
+	if have := feedUntil(&parser.Feed{}, now); !have.IsZero() {
+		t.Errorf("expected no hint, have: %s", have)
+	}
+	if have := feedUntil(&parser.Feed{TTL: time.Hour}, now); !have.Equal(now.Add(time.Hour)) {
+		t.Errorf("invalid ttl hint: %s", have)
+	}
+
+	feed := &parser.Feed{TTL: time.Hour, SkipHours: []int{13, 14}}
+	if have, want := feedUntil(feed, now), now.Truncate(time.Hour).Add(3*time.Hour); !have.Equal(want) {
+		t.Errorf("invalid skip hours hint\nwant: %s\nhave: %s", want, have)
+	}
+
+	feed = &parser.Feed{SkipDays: []time.Weekday{time.Saturday, time.Sunday}}
+	if have, want := feedUntil(feed, now), time.Date(2021, time.May, 3, 0, 0, 0, 0, time.UTC); !have.Equal(want) {
+		t.Errorf("invalid skip days hint\nwant: %s\nhave: %s", want, have)
+	}
+}
@@ -0,0 +1,167 @@
+package worker
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nkanaev/yarr/src/parser"
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+// WebSub (https://www.w3.org/TR/websub/) lets the hubs advertised
+// by the feeds push the updates instead of waiting for the next refresh.
+const (
+	// lease asked from the hubs (they may grant a different one)
+	webSubLease = time.Hour * 24 * 10
+	// how long before the lease expires the subscription is renewed
+	webSubRenewBefore = time.Hour * 24
+	// how long to wait for the hub to verify the request before sending it again
+	webSubRetry = time.Hour
+)
+
+// WebSubEnabled tells whether the hubs are able to reach the service.
+func WebSubEnabled() bool {
+	return config.PublicURL != ""
+}
+
+// WebSubCallback is the url the hub delivers the feed's updates to.
+func WebSubCallback(feedId int64) string {
+	return config.PublicURL + "/websub/" + strconv.FormatInt(feedId, 10)
+}
+
+// SetFeedHub records the WebSub hub advertised by the parsed feed.
+func SetFeedHub(feed storage.Feed, parsed *parser.Feed, db *storage.Storage) {
+	topic := parsed.SelfURL
+	if topic == "" {
+		topic = feed.FeedLink
+	}
+	db.SetWebSubHub(feed.Id, parsed.HubURL, topic)
+}
+
+func (w *Worker) StartWebSubRenewal() {
+	if !WebSubEnabled() {
+		return
+	}
+	w.Go(w.RenewWebSubs)
+	w.every(webSubRetry, w.RenewWebSubs)
+}
+
+// RenewWebSubs sends the (re)subscription requests to the hubs:
+// for the newly found hubs & the leases about to expire.
+func (w *Worker) RenewWebSubs() {
+	if !WebSubEnabled() {
+		return
+	}
+	now := time.Now()
+	for _, websub := range w.db.ListWebSubsDue(now.Add(webSubRenewBefore), now.Add(-webSubRetry)) {
+		if err := w.subscribe(websub); err != nil {
+			log.Printf("Failed to subscribe to %s via %s: %s", websub.Topic, websub.Hub, err)
+		}
+	}
+}
+
+func (w *Worker) subscribe(websub storage.WebSub) error {
+	// keep the secret on renewal, the hub may still be using it
+	secret := websub.Secret
+	if secret == "" {
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		secret = hex.EncodeToString(buf)
+	}
+	// the hub may verify the intent before responding
+	if !w.db.UpdateWebSubRequested(websub.FeedId, secret) {
+		return fmt.Errorf("failed to save subscription")
+	}
+	res, err := client.postForm(w.ctx, websub.Hub, url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {websub.Topic},
+		"hub.callback":      {WebSubCallback(websub.FeedId)},
+		"hub.secret":        {secret},
+		"hub.lease_seconds": {strconv.Itoa(int(webSubLease.Seconds()))},
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Ingest stores the feed's content pushed by the hub.
+// The feeds fetching the full content are stored in the background,
+// so that the hub isn't kept waiting.
+func (w *Worker) Ingest(feed storage.Feed, body io.Reader, contentType string) error {
+	parsed, err := parser.ParseAndFix(body, feed.FeedLink, contentCharset(contentType))
+	if err != nil {
+		return err
+	}
+	items := ConvertItems(parsed.Items, feed)
+	if feed.FullContent {
+		w.Go(func() { w.ingest(feed, items) })
+	} else {
+		w.ingest(feed, items)
+	}
+	return nil
+}
+
+func (w *Worker) ingest(feed storage.Feed, items []storage.Item) {
+	items = w.PrepareItems(feed, items)
+	if len(items) == 0 {
+		return
+	}
+	policy := w.db.FeedRetentionPolicies()[feed.Id]
+	created := w.db.CreateItems(policy.LimitItems(items))
+	if created > 0 {
+		w.db.SyncSearch()
+		w.events.Publish("items_added", map[string]interface{}{
+			"feed_id": feed.Id,
+			"count":   created,
+		})
+		w.PublishStatus()
+	}
+}
+
+// VerifySignature checks the `X-Hub-Signature` header (`method=signature`)
+// of the content delivered by the hub.
+func VerifySignature(secret, header string, body []byte) bool {
+	parts := strings.SplitN(header, "=", 2)
+	if secret == "" || len(parts) != 2 {
+		return false
+	}
+	var algo func() hash.Hash
+	switch strings.ToLower(parts[0]) {
+	case "sha1":
+		algo = sha1.New
+	case "sha256":
+		algo = sha256.New
+	case "sha384":
+		algo = sha512.New384
+	case "sha512":
+		algo = sha512.New
+	default:
+		return false
+	}
+	signature, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(algo, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
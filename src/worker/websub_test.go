@@ -0,0 +1,26 @@
+package worker
+
+import "testing"
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte("hello")
+	testcases := []struct {
+		secret    string
+		signature string
+		want      bool
+	}{
+		{"secret", "sha1=5112055c05f944f85755efc5cd8970e194e9f45b", true},
+		{"secret", "SHA256=88aab3ede8d3adf94d26ab90d3bafd4a2083070c3bcce9c014ee04a443847c0b", true},
+		{"secret", "sha512=db1595ae88a62fd151ec1cba81b98c39df82daae7b4cb9820f446d5bf02f1dcfca6683d88cab3e273f5963ab8ec469a746b5b19086371239f67d1e5f99a79440", true},
+		{"other", "sha1=5112055c05f944f85755efc5cd8970e194e9f45b", false},
+		{"secret", "sha256=88aab3ede8d3adf94d26ab90d3bafd4a2083070c3bcce9c014ee04a443847c0c", false},
+		{"secret", "md5=5d41402abc4b2a76b9719d911017c592", false},
+		{"secret", "sha256", false},
+		{"", "sha256=", false},
+	}
+	for _, testcase := range testcases {
+		if have := VerifySignature(testcase.secret, testcase.signature, body); have != testcase.want {
+			t.Errorf("%q: want %v, have %v", testcase.signature, testcase.want, have)
+		}
+	}
+}
@@ -1,54 +1,159 @@
 package worker
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/nkanaev/yarr/src/content/rewrite"
 	"github.com/nkanaev/yarr/src/storage"
 )
 
-const NUM_WORKERS = 4
-
 type Worker struct {
 	db      *storage.Storage
 	pending *int32
 	refresh *time.Ticker
 	reflock sync.Mutex
 	stopper chan bool
+	events  *Broker
+
+	// cancelled on stop, cutting the requests in progress short
+	ctx    context.Context
+	cancel context.CancelFunc
+	// the background work to wait for on stop
+	running sync.WaitGroup
+	runlock sync.Mutex
+	stopped bool
+
+	// the ids of the feeds being fetched at the moment
+	fetching  map[int64]bool
+	fetchlock sync.Mutex
 }
 
 func NewWorker(db *storage.Storage) *Worker {
 	pending := int32(0)
-	return &Worker{db: db, pending: &pending}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Worker{
+		db:       db,
+		pending:  &pending,
+		events:   NewBroker(),
+		ctx:      ctx,
+		cancel:   cancel,
+		fetching: make(map[int64]bool),
+	}
+}
+
+// ErrStopped is returned for the work requested once the worker is stopped.
+var ErrStopped = errors.New("worker stopped")
+
+// Go runs the function in the background, so that `Stop` waits for it.
+// Does nothing once the worker is stopped.
+func (w *Worker) Go(fn func()) {
+	if !w.begin() {
+		return
+	}
+	go func() {
+		defer w.running.Done()
+		fn()
+	}()
+}
+
+// begin counts the work in, for `Stop` to wait for it (till `running.Done`).
+// Returns false once the worker is stopped.
+func (w *Worker) begin() bool {
+	w.runlock.Lock()
+	defer w.runlock.Unlock()
+	if w.stopped {
+		return false
+	}
+	w.running.Add(1)
+	return true
+}
+
+// every runs the function at the interval until the worker is stopped.
+func (w *Worker) every(interval time.Duration, fn func()) {
+	w.Go(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-w.ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// Stop cancels the requests in progress & waits for the background work
+// (e.g. the refresh storing the items fetched so far) to wind down.
+func (w *Worker) Stop() {
+	w.runlock.Lock()
+	w.stopped = true
+	w.runlock.Unlock()
+
+	w.cancel()
+	w.running.Wait()
 }
 
 func (w *Worker) FeedsPending() int32 {
 	return *w.pending
 }
 
+func (w *Worker) Events() *Broker {
+	return w.events
+}
+
+// Status returns the refresh progress & the unread/starred counters.
+func (w *Worker) Status() map[string]interface{} {
+	return map[string]interface{}{
+		"running": w.FeedsPending(),
+		"stats":   w.db.FeedStats(),
+		"smart":   w.db.SmartFolderStats(),
+	}
+}
+
+// PublishStatus notifies the subscribers about the changed counters.
+func (w *Worker) PublishStatus() {
+	if w.events.Listening() {
+		w.events.Publish("status", w.Status())
+	}
+}
+
 func (w *Worker) StartFeedCleaner() {
-	go w.db.DeleteOldItems()
-	ticker := time.NewTicker(time.Hour * 24)
-	go func() {
-		for {
-			<-ticker.C
-			w.db.DeleteOldItems()
-		}
-	}()
+	w.Go(w.db.DeleteOldItems)
+	w.every(time.Hour*24, w.db.DeleteOldItems)
+}
+
+// how often the feeds' icons are looked for again
+const iconRefreshInterval = time.Hour * 24 * 30
+
+// StartFaviconRefresh looks for the icons missing or not checked for a while,
+// now and then once a day.
+func (w *Worker) StartFaviconRefresh() {
+	w.FindFavicons()
+	w.every(time.Hour*24, w.FindFavicons)
 }
 
 func (w *Worker) FindFavicons() {
-	go func() {
-		for _, feed := range w.db.ListFeedsMissingIcons() {
+	w.Go(func() {
+		for _, feed := range w.db.ListFeedsIconsDue(time.Now().Add(-iconRefreshInterval)) {
+			if w.ctx.Err() != nil {
+				return
+			}
 			w.FindFeedFavicon(feed)
 		}
-	}()
+	})
 }
 
 func (w *Worker) FindFeedFavicon(feed storage.Feed) {
-	icon, err := findFavicon(feed.Link, feed.FeedLink)
+	icon, err := findFavicon(w.ctx, feed.Link, feed.FeedLink, feedOptions(feed, w.db))
 	if err != nil {
 		log.Printf("Failed to find favicon for %s (%s): %s", feed.FeedLink, feed.Link, err)
 	}
@@ -57,11 +162,17 @@ func (w *Worker) FindFeedFavicon(feed storage.Feed) {
 	}
 }
 
+// how often the scheduler looks for the feeds due for refresh
+const schedulerTick = time.Minute
+
+// SetRefreshRate turns the automatic refresh on (or off, if 0).
+// The feeds are fetched as soon as they're due (see `storage.FeedRefreshInterval`),
+// yet no more often than every given number of minutes.
 func (w *Worker) SetRefreshRate(minute int64) {
 	if w.stopper != nil {
 		w.refresh.Stop()
 		w.refresh = nil
-		w.stopper <- true
+		close(w.stopper)
 		w.stopper = nil
 	}
 
@@ -70,23 +181,26 @@ func (w *Worker) SetRefreshRate(minute int64) {
 	}
 
 	w.stopper = make(chan bool)
-	w.refresh = time.NewTicker(time.Minute * time.Duration(minute))
+	w.refresh = time.NewTicker(schedulerTick)
 
-	go func(fire <-chan time.Time, stop <-chan bool, m int64) {
-		log.Printf("auto-refresh %dm: starting", m)
+	fire, stop := w.refresh.C, w.stopper
+	w.Go(func() {
+		log.Printf("auto-refresh %dm: starting", minute)
 		for {
 			select {
 			case <-fire:
-				log.Printf("auto-refresh %dm: firing", m)
-				w.RefreshFeeds()
+				w.RefreshDueFeeds()
 			case <-stop:
-				log.Printf("auto-refresh %dm: stopping", m)
+				log.Printf("auto-refresh %dm: stopping", minute)
+				return
+			case <-w.ctx.Done():
 				return
 			}
 		}
-	}(w.refresh.C, w.stopper, minute)
+	})
 }
 
+// RefreshFeeds fetches all the feeds.
 func (w *Worker) RefreshFeeds() {
 	w.reflock.Lock()
 	defer w.reflock.Unlock()
@@ -96,7 +210,12 @@ func (w *Worker) RefreshFeeds() {
 		return
 	}
 
-	feeds := w.db.ListFeeds()
+	feeds := make([]storage.Feed, 0)
+	for _, feed := range w.db.ListFeeds() {
+		if !feed.Paused {
+			feeds = append(feeds, feed)
+		}
+	}
 	if len(feeds) == 0 {
 		log.Print("Nothing to refresh")
 		return
@@ -104,43 +223,282 @@ func (w *Worker) RefreshFeeds() {
 
 	log.Print("Refreshing feeds")
 	atomic.StoreInt32(w.pending, int32(len(feeds)))
-	go w.refresher(feeds)
+	w.events.Publish("refresh_started", map[string]int{"feeds": len(feeds)})
+	w.Go(func() { w.refresher(feeds) })
+}
+
+// RefreshDueFeeds fetches the feeds whose scheduled refresh time has come.
+func (w *Worker) RefreshDueFeeds() {
+	w.reflock.Lock()
+	defer w.reflock.Unlock()
+
+	if *w.pending > 0 {
+		return
+	}
+
+	feeds := w.db.ListFeedsDue(time.Now())
+	if len(feeds) == 0 {
+		return
+	}
+
+	log.Printf("Refreshing %d due feeds", len(feeds))
+	atomic.StoreInt32(w.pending, int32(len(feeds)))
+	w.events.Publish("refresh_started", map[string]int{"feeds": len(feeds)})
+	w.Go(func() { w.refresher(feeds) })
+}
+
+type refreshResult struct {
+	feed  storage.Feed
+	host  string
+	items []storage.Item
+	err   error
+	// not fetched, as the server asked to wait or the feed is being fetched
+	// already (neither a success nor a failure)
+	skipped bool
 }
 
 func (w *Worker) refresher(feeds []storage.Feed) {
-	w.db.ResetFeedErrors()
+	policies := w.db.FeedRetentionPolicies()
 
-	srcqueue := make(chan storage.Feed, len(feeds))
-	dstqueue := make(chan []storage.Item)
+	w.fetch(feeds, func(result refreshResult) {
+		w.save(result, policies)
+		atomic.AddInt32(w.pending, -1)
+		w.db.SyncSearch()
+		w.PublishStatus()
+	})
 
-	for i := 0; i < NUM_WORKERS; i++ {
-		go w.worker(srcqueue, dstqueue)
+	log.Printf("Finished refreshing %d feeds", len(feeds))
+	w.events.Publish("refresh_finished", map[string]int{"feeds": len(feeds)})
+	w.RenewWebSubs()
+}
+
+// FeedRefreshResult is the outcome of fetching a feed on demand.
+type FeedRefreshResult struct {
+	FeedId   int64  `json:"feed_id"`
+	NewItems int    `json:"new_items"`
+	Error    string `json:"error,omitempty"`
+	// the feed's server asked not to be fetched until later,
+	// or the feed was being fetched already
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// RefreshFeedsNow fetches the given feeds right away (even if a refresh
+// is already in progress, the feeds it's fetching at the moment aside)
+// and waits until they're done. Fails once the worker is stopped.
+func (w *Worker) RefreshFeedsNow(feeds []storage.Feed) ([]FeedRefreshResult, error) {
+	if !w.begin() {
+		return nil, ErrStopped
 	}
+	defer w.running.Done()
 
-	for _, feed := range feeds {
-		srcqueue <- feed
+	results := make([]FeedRefreshResult, 0, len(feeds))
+	if len(feeds) == 0 {
+		return results, nil
 	}
-	for i := 0; i < len(feeds); i++ {
-		items := <-dstqueue
-		if len(items) > 0 {
-			w.db.CreateItems(items)
-			w.db.SetFeedSize(items[0].FeedId, len(items))
+	policies := w.db.FeedRetentionPolicies()
+
+	w.fetch(feeds, func(result refreshResult) {
+		res := FeedRefreshResult{FeedId: result.feed.Id, Skipped: result.skipped}
+		res.NewItems = w.save(result, policies)
+		if result.err != nil {
+			res.Error = result.err.Error()
+		}
+		results = append(results, res)
+	})
+	w.db.SyncSearch()
+	w.PublishStatus()
+	return results, nil
+}
+
+// save stores the fetched items (or the error), schedules the feed's
+// next refresh & lets the subscribers know. Returns the number of the new items.
+func (w *Worker) save(result refreshResult, policies map[int64]storage.RetentionPolicy) int {
+	feedId := result.feed.Id
+	created := 0
+	if result.err != nil && w.ctx.Err() != nil {
+		// cut short by the stop, the feed is still due
+		return 0
+	}
+	if result.skipped {
+		// the feed's error & schedule are left as they are
+		return 0
+	}
+	if result.err != nil {
+		w.db.SetFeedError(feedId, result.err)
+		result.feed.Failures++
+		w.events.Publish("feed_error", map[string]interface{}{
+			"feed_id": feedId,
+			"error":   result.err.Error(),
+		})
+	} else {
+		w.db.ResetFeedError(feedId)
+		result.feed.Failures = 0
+	}
+	if len(result.items) > 0 {
+		created = w.db.CreateItems(policies[feedId].LimitItems(result.items))
+		w.db.SetFeedSize(feedId, len(result.items))
+	}
+	w.db.ScheduleFeedRefresh(feedId, time.Now().Add(w.db.FeedRefreshInterval(result.feed)))
+
+	if created > 0 {
+		w.events.Publish("items_added", map[string]interface{}{
+			"feed_id": feedId,
+			"count":   created,
+		})
+	}
+	w.events.Publish("feed_refreshed", map[string]interface{}{
+		"feed_id":   feedId,
+		"new_items": created,
+	})
+	return created
+}
+
+// fetch downloads the feeds using up to `Config.Workers` workers,
+// with no more than `Config.HostWorkers` of them busy with the same host
+// (so that a slow host doesn't hold up the rest). The results are
+// handled one at a time, as they come.
+func (w *Worker) fetch(feeds []storage.Feed, handle func(refreshResult)) {
+	feeds, busy := w.claim(feeds)
+	for _, feed := range busy {
+		handle(refreshResult{feed: feed, host: feedHost(feed), skipped: true})
+	}
+	if len(feeds) == 0 {
+		return
+	}
+
+	numWorkers := config.Workers
+	if numWorkers > len(feeds) {
+		numWorkers = len(feeds)
+	}
+	srcqueue := make(chan storage.Feed)
+	dstqueue := make(chan refreshResult)
+	for i := 0; i < numWorkers; i++ {
+		go w.worker(srcqueue, dstqueue)
+	}
+
+	queued := make([]storage.Feed, len(feeds))
+	copy(queued, feeds)
+	busyHosts := make(map[string]int)
+	busyWorkers := 0
+
+	for done := 0; done < len(feeds); {
+		// pick the first feed whose host isn't too busy
+		next := -1
+		if busyWorkers < numWorkers {
+			for i, feed := range queued {
+				if busyHosts[feedHost(feed)] < config.HostWorkers {
+					next = i
+					break
+				}
+			}
+		}
+		// sending to a nil channel blocks, so that only the results are awaited
+		var send chan<- storage.Feed
+		var nextFeed storage.Feed
+		if next != -1 {
+			send = srcqueue
+			nextFeed = queued[next]
+		}
+
+		select {
+		case send <- nextFeed:
+			queued = append(queued[:next], queued[next+1:]...)
+			busyHosts[feedHost(nextFeed)]++
+			busyWorkers++
+		case result := <-dstqueue:
+			busyHosts[result.host]--
+			busyWorkers--
+			done++
+			handle(result)
+			w.release(result.feed)
 		}
-		atomic.AddInt32(w.pending, -1)
-		w.db.SyncSearch()
 	}
 	close(srcqueue)
-	close(dstqueue)
+}
 
-	log.Printf("Finished refreshing %d feeds", len(feeds))
+// claim marks the feeds as being fetched, telling apart
+// the ones some other refresh is fetching already.
+func (w *Worker) claim(feeds []storage.Feed) (claimed, busy []storage.Feed) {
+	w.fetchlock.Lock()
+	defer w.fetchlock.Unlock()
+	for _, feed := range feeds {
+		if w.fetching[feed.Id] {
+			busy = append(busy, feed)
+			continue
+		}
+		w.fetching[feed.Id] = true
+		claimed = append(claimed, feed)
+	}
+	return
+}
+
+func (w *Worker) release(feed storage.Feed) {
+	w.fetchlock.Lock()
+	defer w.fetchlock.Unlock()
+	delete(w.fetching, feed.Id)
 }
 
-func (w *Worker) worker(srcqueue <-chan storage.Feed, dstqueue chan<- []storage.Item) {
+func feedHost(feed storage.Feed) string {
+	u, err := url.Parse(feed.FeedLink)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+func (w *Worker) worker(srcqueue <-chan storage.Feed, dstqueue chan<- refreshResult) {
 	for feed := range srcqueue {
-		items, err := listItems(feed, w.db)
-		if err != nil {
-			w.db.SetFeedError(feed.Id, err)
+		host := feedHost(feed)
+		items, err := listItems(w.ctx, &feed, w.db)
+		if err == errNotAllowed {
+			dstqueue <- refreshResult{feed: feed, host: host, skipped: true}
+			continue
 		}
-		dstqueue <- items
+		if err == nil {
+			items = w.PrepareItems(feed, items)
+		}
+		dstqueue <- refreshResult{feed: feed, host: host, items: items, err: err}
+	}
+}
+
+// PrepareItems gets the feed's fetched (or pushed) items ready to be stored:
+// rewrites their content with the feed's steps, runs them through the rules
+// & fetches their full content (rewritten too), if the feed opts in.
+func (w *Worker) PrepareItems(feed storage.Feed, items []storage.Item) []storage.Item {
+	rewriter := feed.Rewrite.Compile()
+	if !rewriter.Empty() {
+		for i := range items {
+			rewriteItem(&items[i], rewriter)
+		}
+	}
+	items = w.db.ApplyRules(feed, items)
+	if feed.FullContent && len(items) > 0 {
+		items = fetchFullContent(w.ctx, feed, items, w.db)
+		if !rewriter.Empty() {
+			// the items with the summary kept got the article instead,
+			// the summary stays as it came from the feed
+			for i := range items {
+				if items[i].Summary == nil {
+					continue
+				}
+				if items[i].RawContent != nil {
+					items[i].Summary = items[i].RawContent
+					items[i].RawContent = nil
+				}
+				rewriteItem(&items[i], rewriter)
+			}
+		}
+	}
+	return items
+}
+
+// rewriteItem applies the rewrite steps to the item's content,
+// keeping the content as it was if they changed it.
+func rewriteItem(item *storage.Item, rewriter *rewrite.Rewriter) {
+	content := rewriter.Apply(item.Content)
+	if content != item.Content {
+		raw := item.Content
+		item.RawContent = &raw
+		item.Content = content
 	}
 }
@@ -0,0 +1,395 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nkanaev/yarr/src/content/rewrite"
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+func TestFetchHostLimit(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer slow.Close()
+	var userAgent string
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer fast.Close()
+
+	defer Configure(DefaultConfig)
+	Configure(Config{UserAgent: "Yarr/test", Timeout: time.Second, ConnectTimeout: time.Second, Workers: 4, HostWorkers: 2})
+
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+	feeds := make([]storage.Feed, 0)
+	for i := 0; i < 6; i++ {
+		feeds = append(feeds, *db.CreateFeed("", "", "", fmt.Sprintf("%s/feed%d.xml", slow.URL, i), nil))
+	}
+	fastFeed := db.CreateFeed("", "", "", fast.URL+"/feed.xml", nil)
+	db.UpdateFeedUserAgent(fastFeed.Id, "Custom/1.0")
+	feeds = append(feeds, *db.GetFeed(fastFeed.Id))
+
+	order := make([]int64, 0)
+	NewWorker(db).fetch(feeds, func(result refreshResult) {
+		if result.err != nil {
+			t.Errorf("failed to fetch %s: %s", result.feed.FeedLink, result.err)
+		}
+		order = append(order, result.feed.Id)
+	})
+	if len(order) != len(feeds) {
+		t.Fatalf("expected %d results, have %d", len(feeds), len(order))
+	}
+	if maxRunning != 2 {
+		t.Errorf("expected at most 2 requests to the same host at once, have: %d", maxRunning)
+	}
+	// the slow host doesn't hold up the others
+	if order[0] != fastFeed.Id {
+		t.Errorf("expected the fast feed to be done first, have: %v", order)
+	}
+	if userAgent != "Custom/1.0" {
+		t.Errorf("invalid user agent: %#v", userAgent)
+	}
+}
+
+func TestFetchMovedAndGone(t *testing.T) {
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old.xml":
+			http.Redirect(w, r, "/moved.xml", http.StatusMovedPermanently)
+		case "/moved.xml":
+			http.Redirect(w, r, "/temporary.xml", http.StatusFound)
+		case "/temporary.xml":
+			w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><item><guid>1</guid></item></channel></rss>`))
+		case "/gone.xml":
+			w.WriteHeader(http.StatusGone)
+		case "/parked.xml":
+			http.Redirect(w, r, "/login", http.StatusMovedPermanently)
+		case "/login":
+			w.Write([]byte(`<html><body><form>Sign in</form></body></html>`))
+		}
+	}))
+	defer feedServer.Close()
+
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+	moved := db.CreateFeed("moved", "", "", feedServer.URL+"/old.xml", nil)
+	gone := db.CreateFeed("gone", "", "", feedServer.URL+"/gone.xml", nil)
+	parked := db.CreateFeed("parked", "", "", feedServer.URL+"/parked.xml", nil)
+
+	results, _ := NewWorker(db).RefreshFeedsNow([]storage.Feed{*moved, *gone, *parked})
+	if len(results) != 3 {
+		t.Fatalf("invalid results: %#v", results)
+	}
+
+	if have := db.GetFeed(moved.Id).FeedLink; have != feedServer.URL+"/moved.xml" {
+		t.Errorf("expected the feed link to follow the permanent redirect only, have: %s", have)
+	}
+	if events := db.ListFeedEvents(moved.Id); len(events) != 1 || events[0].Kind != storage.FeedMoved {
+		t.Errorf("invalid events: %#v", events)
+	}
+	if have := db.GetFeed(parked.Id).FeedLink; have != feedServer.URL+"/parked.xml" {
+		t.Errorf("expected the feed link to be kept when the new url isn't a feed, have: %s", have)
+	}
+	if events := db.ListFeedEvents(parked.Id); len(events) != 0 {
+		t.Errorf("expected no events, have: %#v", events)
+	}
+	if feed := db.GetFeed(gone.Id); !feed.Paused {
+		t.Error("expected the gone feed to be paused")
+	}
+	if errors := db.GetFeedErrors(); errors[gone.Id] != "feed gone" {
+		t.Errorf("invalid feed errors: %#v", errors)
+	}
+}
+
+func TestFetchRetry(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		count := requests[r.URL.Path]
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/flaky.xml":
+			if count <= 2 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><item><guid>1</guid></item></channel></rss>`))
+		case "/broken.xml":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/missing.xml":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer feedServer.Close()
+
+	defer Configure(DefaultConfig)
+	Configure(Config{Timeout: time.Second, ConnectTimeout: time.Second, Workers: 4, Retries: 2, RetryDelay: time.Millisecond})
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(":memory:")
+	flaky := db.CreateFeed("flaky", "", "", feedServer.URL+"/flaky.xml", nil)
+	broken := db.CreateFeed("broken", "", "", feedServer.URL+"/broken.xml", nil)
+	missing := db.CreateFeed("missing", "", "", feedServer.URL+"/missing.xml", nil)
+	hourly := int64(60)
+	db.UpdateFeedRefreshInterval(broken.Id, &hourly)
+	broken = db.GetFeed(broken.Id)
+
+	w := NewWorker(db)
+	w.RefreshFeedsNow([]storage.Feed{*flaky, *broken, *missing})
+	if requests["/flaky.xml"] != 3 || requests["/broken.xml"] != 3 || requests["/missing.xml"] != 1 {
+		t.Fatalf("expected the server errors only to be retried, have: %#v", requests)
+	}
+	if errors := db.GetFeedErrors(); len(errors) != 2 || errors[broken.Id] != "status code 500" {
+		t.Fatalf("invalid feed errors: %#v", errors)
+	}
+
+	// the failures in a row put the feed off
+	w.RefreshFeedsNow([]storage.Feed{*db.GetFeed(broken.Id), *db.GetFeed(flaky.Id)})
+	feed := db.GetFeed(broken.Id)
+	if feed.Failures != 2 || len(db.ListFeedErrors(broken.Id)) != 2 {
+		t.Fatalf("expected 2 failures, have: %d", feed.Failures)
+	}
+	if feed.NextFetch == nil || time.Until(*feed.NextFetch) <= time.Hour {
+		t.Fatalf("expected the feed to be put off, next fetch: %v", feed.NextFetch)
+	}
+	if feed := db.GetFeed(flaky.Id); feed.Failures != 0 {
+		t.Fatalf("expected the flaky feed to have no failures, have: %d", feed.Failures)
+	}
+}
+
+func TestFetchNotAllowed(t *testing.T) {
+	requested := false
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer feedServer.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(":memory:")
+	feed := db.CreateFeed("limited", "", "", feedServer.URL+"/feed.xml", nil)
+	db.SetFeedError(feed.Id, fmt.Errorf("status code 429"))
+	db.SetFeedError(feed.Id, fmt.Errorf("status code 429"))
+	db.SetHTTPNextAllowed(feed.Id, time.Now().Add(time.Hour))
+
+	results, _ := NewWorker(db).RefreshFeedsNow([]storage.Feed{*db.GetFeed(feed.Id)})
+	if len(results) != 1 || !results[0].Skipped || results[0].Error != "" {
+		t.Fatalf("expected the feed to be skipped, have: %#v", results)
+	}
+	if requested {
+		t.Fatal("expected the feed not to be fetched")
+	}
+	if have := db.GetFeed(feed.Id); have.Failures != 2 || have.NextFetch != nil {
+		t.Fatalf("expected the feed's state to be kept, have: %d failures, next fetch %v", have.Failures, have.NextFetch)
+	}
+	if errors := db.GetFeedErrors(); errors[feed.Id] != "status code 429" {
+		t.Fatalf("expected the error to be kept, have: %#v", errors)
+	}
+}
+
+func TestFetchRedirectCredentials(t *testing.T) {
+	received := make(map[string]http.Header)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received["other"] = r.Header.Clone()
+	}))
+	defer other.Close()
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved.xml":
+			http.Redirect(w, r, "/feed.xml", http.StatusMovedPermanently)
+		case "/feed.xml":
+			received["same"] = r.Header.Clone()
+		default:
+			http.Redirect(w, r, other.URL+"/feed.xml", http.StatusFound)
+		}
+	}))
+	defer feedServer.Close()
+
+	opts := fetchOptions{credentials: &storage.FeedCredentials{
+		Token:   "secret",
+		Headers: map[string]string{"X-Api-Key": "secret"},
+		Cookies: map[string]string{"session": "secret"},
+	}}
+	for _, path := range []string{"/moved.xml", "/elsewhere.xml"} {
+		res, err := client.fetch(context.Background(), feedServer.URL+path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if same := received["same"]; same.Get("X-Api-Key") != "secret" || same.Get("Authorization") == "" || same.Get("Cookie") == "" {
+		t.Fatalf("expected the credentials to follow the redirect within the host, have: %#v", same)
+	}
+	if other := received["other"]; other.Get("X-Api-Key") != "" || other.Get("Authorization") != "" || other.Get("Cookie") != "" || other.Get("User-Agent") == "" {
+		t.Fatalf("expected the credentials to be dropped on the redirect to another host, have: %#v", other)
+	}
+}
+
+func TestPrepareItemsRewrite(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(":memory:")
+	feed := db.CreateFeed("", "", "", "http://example.com/feed.xml", nil)
+	db.UpdateFeedRewrite(feed.Id, rewrite.Pipeline{{Type: rewrite.Remove, Selector: ".ad"}})
+	db.CreateRule(storage.Rule{Field: storage.RuleContent, Match: storage.RuleKeyword, Pattern: "buy now", Action: storage.RuleStar, Enabled: true})
+
+	items := NewWorker(db).PrepareItems(*db.GetFeed(feed.Id), []storage.Item{
+		{GUID: "1", FeedId: feed.Id, Content: `<p>text</p><div class="ad">buy now</div>`},
+		{GUID: "2", FeedId: feed.Id, Content: `<p>buy now</p>`},
+	})
+	if len(items) != 2 || items[0].Content != "<p>text</p>" {
+		t.Fatalf("expected the content to be rewritten, have: %#v", items)
+	}
+	if items[0].IsStarred || !items[1].IsStarred {
+		t.Fatal("expected the rules to see the rewritten content")
+	}
+	if items[0].RawContent == nil || *items[0].RawContent != `<p>text</p><div class="ad">buy now</div>` || items[1].RawContent != nil {
+		t.Fatalf("expected the content before the steps to be kept, have: %#v, %#v", items[0].RawContent, items[1].RawContent)
+	}
+	db.CreateItems(items)
+
+	// new steps aren't taken for an edit of the known items
+	db.UpdateFeedRewrite(feed.Id, rewrite.Pipeline{{Type: rewrite.Replace, Pattern: "text", Replacement: "news"}})
+	items = NewWorker(db).PrepareItems(*db.GetFeed(feed.Id), []storage.Item{
+		{GUID: "1", FeedId: feed.Id, Content: `<p>text</p><div class="ad">buy now</div>`},
+	})
+	db.CreateItems(items)
+	stored := db.ListItems(storage.ItemFilter{FeedID: &feed.Id}, 10, false, false)
+	for _, item := range stored {
+		if revisions := db.ListItemRevisions(item.Id); len(revisions) != 0 {
+			t.Fatalf("expected no revisions of %s, have: %#v", item.GUID, revisions)
+		}
+	}
+}
+
+func TestRefreshFeedsNowInFlight(t *testing.T) {
+	release := make(chan struct{})
+	requested := make(chan struct{}, 1)
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer hanging.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(":memory:")
+	feed := db.CreateFeed("", "", "", hanging.URL+"/feed.xml", nil)
+
+	w := NewWorker(db)
+	defer w.Stop()
+	w.RefreshFeeds()
+	<-requested
+
+	results, _ := w.RefreshFeedsNow([]storage.Feed{*feed})
+	close(release)
+	if len(results) != 1 || !results[0].Skipped {
+		t.Fatalf("expected the feed being fetched to be skipped, have: %#v", results)
+	}
+	select {
+	case <-requested:
+		t.Fatal("expected the feed not to be fetched twice")
+	default:
+	}
+}
+
+func TestStop(t *testing.T) {
+	release := make(chan struct{})
+	requested := make(chan struct{}, 1)
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer hanging.Close()
+	defer close(release)
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(":memory:")
+	db.CreateFeed("", "", "", hanging.URL+"/feed.xml", nil)
+
+	w := NewWorker(db)
+	w.RefreshFeeds()
+	<-requested
+
+	stopped := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh in progress not cancelled")
+	}
+	if w.FeedsPending() != 0 {
+		t.Fatalf("expected refresh to be finished, pending: %d", w.FeedsPending())
+	}
+	if errors := db.GetFeedErrors(); len(errors) != 0 {
+		t.Fatalf("cancelled fetch must not be recorded as error: %#v", errors)
+	}
+
+	// no new work once stopped
+	ran := false
+	w.Go(func() { ran = true })
+	w.Stop()
+	if ran {
+		t.Fatal("expected no work after stop")
+	}
+	if _, err := w.RefreshFeedsNow(db.ListFeeds()); err != ErrStopped {
+		t.Fatalf("expected on-demand refresh to be refused after stop, have: %v", err)
+	}
+
+	// on-demand refreshes in progress are cut short as well
+	w = NewWorker(db)
+	done := make(chan struct{})
+	go func() {
+		w.RefreshFeedsNow(db.ListFeeds())
+		close(done)
+	}()
+	<-requested
+	w.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("on-demand refresh in progress not cancelled")
+	}
+}